@@ -0,0 +1,245 @@
+// Package client talks to a FileOrcha server for command line and other
+// non-browser clients. It solves proof-of-work challenges the same way
+// pow.js does for the web pages.
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/bits"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// powHeader carries a solved challenge, see pow.Header
+const powHeader = "X-Proof-Of-Work"
+
+// maxDifficulty refuses challenges that would take a client far too long
+const maxDifficulty = 32
+
+// Client is a FileOrcha API client. It remembers solved challenges per
+// file, so several requests for one file only solve once.
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+
+	solutions map[string]string
+}
+
+// New returns a client for the server at baseURL
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:   strings.TrimRight(baseURL, "/"),
+		HTTP:      &http.Client{Timeout: 5 * time.Minute},
+		solutions: make(map[string]string),
+	}
+}
+
+// UploadOptions are the optional upload form fields
+type UploadOptions struct {
+	Downloads int
+	Expiry    int
+	Password  string
+}
+
+// UploadResult is the part of the upload response clients need
+type UploadResult struct {
+	ID            string `json:"id"`
+	URL           string `json:"url"`
+	DownloadsLeft int    `json:"downloads_left"`
+	ExpiresAt     string `json:"expires_at"`
+	OwnerToken    string `json:"owner_token"`
+}
+
+// Upload stores content as a new file named name
+func (c *Client) Upload(name string, content io.Reader, opts UploadOptions) (UploadResult, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return UploadResult{}, err
+	}
+	if opts.Downloads > 0 {
+		form.WriteField("downloads", strconv.Itoa(opts.Downloads))
+	}
+	if opts.Expiry > 0 {
+		form.WriteField("expiry", strconv.Itoa(opts.Expiry))
+	}
+	if opts.Password != "" {
+		form.WriteField("password", opts.Password)
+	}
+	if err := form.Close(); err != nil {
+		return UploadResult{}, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.BaseURL+"/upload", &body)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return UploadResult{}, responseError(resp)
+	}
+	var result UploadResult
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
+
+// DownloadOptions are the optional download query parameters
+type DownloadOptions struct {
+	Password string
+	OTP      string
+}
+
+// Download is an open download. The caller reads and closes Body.
+type Download struct {
+	FileName      string
+	DownloadsLeft string
+	Body          io.ReadCloser
+}
+
+// Download fetches file id, which uses up one of its downloads
+func (c *Client) Download(id string, opts DownloadOptions) (*Download, error) {
+	query := url.Values{}
+	if opts.Password != "" {
+		query.Set("password", opts.Password)
+	}
+	if opts.OTP != "" {
+		query.Set("otp", opts.OTP)
+	}
+	target := c.BaseURL + "/file/" + url.PathEscape(id)
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	resp, err := c.Get(id, target)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return &Download{
+		FileName:      attachmentName(resp.Header.Get("Content-Disposition")),
+		DownloadsLeft: resp.Header.Get("X-Downloads-Left"),
+		Body:          resp.Body,
+	}, nil
+}
+
+// Get requests target, an endpoint for file id that may ask for a proof
+// of work, solving the challenge when one comes back
+func (c *Client) Get(id, target string) (*http.Response, error) {
+	resp, err := c.get(id, target)
+	if err != nil || resp.StatusCode != http.StatusPreconditionRequired {
+		return resp, err
+	}
+	defer resp.Body.Close()
+	var challenge struct {
+		Challenge  string `json:"challenge"`
+		Difficulty int    `json:"difficulty"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&challenge); err != nil {
+		return nil, fmt.Errorf("reading proof-of-work challenge: %w", err)
+	}
+	if challenge.Difficulty > maxDifficulty {
+		return nil, fmt.Errorf("proof-of-work difficulty %d is too high", challenge.Difficulty)
+	}
+	c.solutions[id] = Solve(challenge.Challenge, challenge.Difficulty)
+	return c.get(id, target)
+}
+
+func (c *Client) get(id, target string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if solution := c.solutions[id]; solution != "" {
+		req.Header.Set(powHeader, solution)
+	}
+	return c.HTTP.Do(req)
+}
+
+// Solve finds a counter such that the SHA-256 of "challenge:counter"
+// starts with difficulty zero bits, and returns that solution
+func Solve(challenge string, difficulty int) string {
+	prefix := challenge + ":"
+	for counter := uint64(0); ; counter++ {
+		solution := prefix + strconv.FormatUint(counter, 10)
+		if leadingZeroBits(sha256.Sum256([]byte(solution))) >= difficulty {
+			return solution
+		}
+	}
+}
+
+func leadingZeroBits(sum [sha256.Size]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// attachmentName returns a safe local file name from a Content-Disposition
+// header
+func attachmentName(disposition string) string {
+	name := ""
+	if _, params, err := mime.ParseMediaType(disposition); err == nil {
+		name = params["filename"]
+	} else if _, raw, ok := strings.Cut(disposition, "filename="); ok {
+		name = strings.Trim(raw, `"`)
+	}
+	return safeName(name)
+}
+
+// safeName keeps only the base of a file name from the other end, so it
+// can't write elsewhere
+func safeName(name string) string {
+	name = filepath.Base(filepath.FromSlash(strings.ReplaceAll(name, `\`, "/")))
+	if name == "." || name == ".." || name == string(os.PathSeparator) || name == "" {
+		return "download"
+	}
+	return name
+}
+
+// responseError turns a failed response into an error carrying the
+// server's plain text message
+func responseError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	text := strings.TrimSpace(string(msg))
+	if text == "" {
+		text = resp.Status
+	}
+	return &StatusError{Code: resp.StatusCode, Message: text}
+}
+
+// StatusError is a non-success answer from the server
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// powServer serves one file behind a proof-of-work challenge and counts
+// the challenges it handed out
+func powServer(t *testing.T, difficulty int) (*httptest.Server, *int) {
+	t.Helper()
+	challenges := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/file/abc123" {
+			http.NotFound(w, r)
+			return
+		}
+		solution := r.Header.Get(powHeader)
+		challenge, _, _ := strings.Cut(solution, ":")
+		if challenge != "test-challenge" || leadingZeroBits(sha256.Sum256([]byte(solution))) < difficulty {
+			challenges++
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusPreconditionRequired)
+			json.NewEncoder(w).Encode(map[string]any{"challenge": "test-challenge", "difficulty": difficulty})
+			return
+		}
+		if r.URL.Query().Get("password") != "secret" {
+			http.Error(w, "Wrong or missing password", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Disposition", "attachment; filename=../../report.txt")
+		w.Header().Set("X-Downloads-Left", "1")
+		io.WriteString(w, "contents")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &challenges
+}
+
+func TestSolve(t *testing.T) {
+	solution := Solve("abc", 12)
+	if !strings.HasPrefix(solution, "abc:") {
+		t.Fatalf("solution %q doesn't start with the challenge", solution)
+	}
+	if bits := leadingZeroBits(sha256.Sum256([]byte(solution))); bits < 12 {
+		t.Errorf("solution %q has %d leading zero bits, want 12", solution, bits)
+	}
+}
+
+func TestDownloadSolvesChallengeOnce(t *testing.T) {
+	srv, challenges := powServer(t, 10)
+	c := New(srv.URL)
+
+	for range 2 {
+		d, err := c.Download("abc123", DownloadOptions{Password: "secret"})
+		if err != nil {
+			t.Fatalf("Download: %v", err)
+		}
+		body, _ := io.ReadAll(d.Body)
+		d.Body.Close()
+		if string(body) != "contents" {
+			t.Errorf("body = %q", body)
+		}
+		if d.FileName != "report.txt" {
+			t.Errorf("file name = %q, want the base name only", d.FileName)
+		}
+	}
+	if *challenges != 1 {
+		t.Errorf("server handed out %d challenges, want 1", *challenges)
+	}
+}
+
+func TestDownloadReportsServerMessage(t *testing.T) {
+	srv, _ := powServer(t, 4)
+	_, err := New(srv.URL).Download("abc123", DownloadOptions{Password: "wrong"})
+	if err == nil || !strings.Contains(err.Error(), "Wrong or missing password") {
+		t.Errorf("err = %v, want the server's message", err)
+	}
+}
+
+func TestAttachmentName(t *testing.T) {
+	tests := map[string]string{
+		`attachment; filename="notes.txt"`:   "notes.txt",
+		"attachment; filename=my notes.txt":  "my notes.txt",
+		`attachment; filename="..\evil.exe"`: "evil.exe",
+		"attachment; filename=/etc/passwd":   "passwd",
+		"attachment; filename=..":            "download",
+		"":                                   "download",
+	}
+	for header, want := range tests {
+		if got := attachmentName(header); got != want {
+			t.Errorf("attachmentName(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/cloudflare/circl/group"
+	"golang.org/x/crypto/hkdf"
+)
+
+// SPAKE2 over ristretto255, after RFC 9382. The sender is side A and the
+// receiver side B. M and N are hashed to the group, so nobody knows their
+// discrete logarithms.
+var (
+	spakeGroup = group.Ristretto255
+	spakeDST   = []byte("FileOrcha-SPAKE2-ristretto255-v1")
+	spakeM     = spakeGroup.HashToElement([]byte("M"), spakeDST)
+	spakeN     = spakeGroup.HashToElement([]byte("N"), spakeDST)
+)
+
+var errBadPakeMessage = errors.New("invalid SPAKE2 message from the other side")
+
+// spakeRole is a side of the exchange. Its blinding point and the other
+// side's are swapped between A and B.
+type spakeRole bool
+
+const (
+	spakeA spakeRole = true
+	spakeB spakeRole = false
+)
+
+// spake is one side of a SPAKE2 exchange in progress
+type spake struct {
+	role spakeRole
+	w    group.Scalar
+	x    group.Scalar
+	msg  []byte
+}
+
+// newSpake starts an exchange for password and returns the message to send
+func newSpake(role spakeRole, password string) (*spake, error) {
+	s := &spake{
+		role: role,
+		w:    spakeGroup.HashToScalar([]byte(password), spakeDST),
+		x:    spakeGroup.RandomNonZeroScalar(rand.Reader),
+	}
+	own, _ := s.blinds()
+	blind := spakeGroup.NewElement().Mul(own, s.w)
+	public := spakeGroup.NewElement().MulGen(s.x)
+	msg, err := public.Add(public, blind).MarshalBinaryCompress()
+	if err != nil {
+		return nil, err
+	}
+	s.msg = msg
+	return s, nil
+}
+
+// blinds returns this side's blinding point and the other side's
+func (s *spake) blinds() (group.Element, group.Element) {
+	if s.role == spakeA {
+		return spakeM, spakeN
+	}
+	return spakeN, spakeM
+}
+
+// finish takes the other side's message and derives the shared key. Both
+// sides only get the same key when they used the same password.
+func (s *spake) finish(peer []byte) ([]byte, error) {
+	peerElement := spakeGroup.NewElement()
+	if err := peerElement.UnmarshalBinary(peer); err != nil || peerElement.IsIdentity() {
+		return nil, errBadPakeMessage
+	}
+	_, other := s.blinds()
+	unblind := spakeGroup.NewElement().Mul(other, s.w)
+	unblind.Neg(unblind)
+	k := spakeGroup.NewElement().Add(peerElement, unblind)
+	k.Mul(k, s.x)
+	if k.IsIdentity() {
+		return nil, errBadPakeMessage
+	}
+	kBytes, err := k.MarshalBinaryCompress()
+	if err != nil {
+		return nil, err
+	}
+	wBytes, err := s.w.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	msgA, msgB := s.msg, peer
+	if s.role == spakeB {
+		msgA, msgB = peer, s.msg
+	}
+	transcript := sha256.New()
+	for _, part := range [][]byte{[]byte("A"), []byte("B"), msgA, msgB, kBytes, wBytes} {
+		binary.Write(transcript, binary.LittleEndian, uint64(len(part)))
+		transcript.Write(part)
+	}
+	key := make([]byte, 32)
+	_, err = io.ReadFull(hkdf.New(sha256.New, transcript.Sum(nil), nil, []byte("FileOrcha transfer key")), key)
+	return key, err
+}
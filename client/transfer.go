@@ -0,0 +1,365 @@
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Short-code transfers, magic-wormhole style. The sender gets a nameplate
+// from the server and adds two words it picks itself; both sides run
+// SPAKE2 on the whole code through the mailbox. The sender then uploads
+// the file encrypted under the shared key and posts the encrypted link,
+// and the receiver confirms once it has the file. The server only ever
+// sees the nameplate, SPAKE2 messages and ciphertext.
+const (
+	phasePake = "pake"
+	phaseLink = "link"
+	phaseDone = "done"
+
+	codeWords = 2
+	// transferExpiry matches the mailbox lifetime; the upload is useless
+	// once the mailbox is gone
+	transferExpiry = 10 * time.Minute
+	mailboxWait    = 30
+)
+
+// ErrWrongCode is returned when the two sides used different codes
+var ErrWrongCode = errors.New("the code doesn't match, check it with the sender")
+
+// errMailboxClosed means the other side gave up, or the mailbox expired
+var errMailboxClosed = errors.New("the transfer was closed")
+
+// transferLink tells the receiver where the encrypted file is
+type transferLink struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+type mailboxMessage struct {
+	Side  string `json:"side"`
+	Phase string `json:"phase"`
+	Body  string `json:"body"`
+}
+
+// mailbox is one side's view of a mailbox on the server
+type mailbox struct {
+	c         *Client
+	nameplate int
+	side      string
+	next      int64
+	deadline  time.Time
+}
+
+// Send offers content under name as a short-code transfer. showCode is
+// called with the code as soon as it is known, to pass on to the
+// receiver. Send returns once the receiver confirmed it got the file.
+func (c *Client) Send(name string, content []byte, showCode func(code string)) error {
+	var created struct {
+		Nameplate int `json:"nameplate"`
+	}
+	if err := c.postJSON("/mailbox", nil, &created); err != nil {
+		return fmt.Errorf("creating mailbox: %w", err)
+	}
+	words, err := c.codeWords()
+	if err != nil {
+		return err
+	}
+	code := strconv.Itoa(created.Nameplate) + "-" + strings.Join(words, "-")
+
+	m, err := c.openMailbox(created.Nameplate)
+	if err != nil {
+		return err
+	}
+	defer m.close()
+	showCode(code)
+
+	key, err := m.exchangeKeys(spakeA, code)
+	if err != nil {
+		return err
+	}
+	sealed, err := seal(key, content)
+	if err != nil {
+		return err
+	}
+	// The real name only travels inside the encrypted link
+	uploaded, err := c.Upload("transfer", bytes.NewReader(sealed), UploadOptions{
+		Downloads: 1,
+		Expiry:    int(transferExpiry / time.Minute),
+	})
+	if err != nil {
+		return fmt.Errorf("uploading: %w", err)
+	}
+	link, err := json.Marshal(transferLink{ID: uploaded.ID, Name: name, Size: len(content)})
+	if err != nil {
+		return err
+	}
+	if err := m.postSealed(key, phaseLink, link); err != nil {
+		return err
+	}
+
+	done, err := m.waitFor(phaseDone)
+	if err != nil {
+		return fmt.Errorf("waiting for the receiver: %w", err)
+	}
+	if _, err := openSealed(key, done); err != nil {
+		return ErrWrongCode
+	}
+	return nil
+}
+
+// Receive fetches the file sent with code and returns its name and
+// contents
+func (c *Client) Receive(code string) (string, []byte, error) {
+	plate, _, ok := strings.Cut(code, "-")
+	nameplate, err := strconv.Atoi(plate)
+	if !ok || err != nil || nameplate < 1 {
+		return "", nil, errors.New(`codes look like "7-guitar-orbit"`)
+	}
+	m, err := c.openMailbox(nameplate)
+	if err != nil {
+		return "", nil, err
+	}
+	// The sender closes the mailbox once it has read the confirmation;
+	// closing it on failure tells the sender to stop waiting
+	done := false
+	defer func() {
+		if !done {
+			m.close()
+		}
+	}()
+
+	key, err := m.exchangeKeys(spakeB, code)
+	if err != nil {
+		return "", nil, err
+	}
+	body, err := m.waitFor(phaseLink)
+	if err != nil {
+		return "", nil, fmt.Errorf("waiting for the sender: %w", err)
+	}
+	raw, err := openSealed(key, body)
+	if err != nil {
+		return "", nil, ErrWrongCode
+	}
+	var link transferLink
+	if err := json.Unmarshal(raw, &link); err != nil {
+		return "", nil, err
+	}
+
+	d, err := c.Download(link.ID, DownloadOptions{})
+	if err != nil {
+		return "", nil, fmt.Errorf("downloading: %w", err)
+	}
+	defer d.Body.Close()
+	sealed, err := io.ReadAll(d.Body)
+	if err != nil {
+		return "", nil, err
+	}
+	content, err := open(key, sealed)
+	if err != nil || len(content) != link.Size {
+		return "", nil, errors.New("the transferred file is damaged")
+	}
+	if err := m.postSealed(key, phaseDone, []byte("ok")); err != nil {
+		return "", nil, err
+	}
+	done = true
+	return safeName(link.Name), content, nil
+}
+
+// codeWords picks the words of a new code from the server's list
+func (c *Client) codeWords() ([]string, error) {
+	resp, err := c.HTTP.Get(c.BaseURL + "/mailbox/words")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	var list []string
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	if len(list) < 2 {
+		return nil, errors.New("server sent no code words")
+	}
+	words := make([]string, codeWords)
+	for i := range words {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(list))))
+		if err != nil {
+			return nil, err
+		}
+		words[i] = list[n.Int64()]
+	}
+	return words, nil
+}
+
+func (c *Client) openMailbox(nameplate int) (*mailbox, error) {
+	side := make([]byte, 8)
+	if _, err := rand.Read(side); err != nil {
+		return nil, err
+	}
+	return &mailbox{
+		c:         c,
+		nameplate: nameplate,
+		side:      hex.EncodeToString(side),
+		deadline:  time.Now().Add(transferExpiry),
+	}, nil
+}
+
+// exchangeKeys runs SPAKE2 with the other side and returns the shared key
+func (m *mailbox) exchangeKeys(role spakeRole, code string) ([]byte, error) {
+	s, err := newSpake(role, code)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.post(phasePake, base64.RawURLEncoding.EncodeToString(s.msg)); err != nil {
+		return nil, err
+	}
+	body, err := m.waitFor(phasePake)
+	if err != nil {
+		return nil, fmt.Errorf("waiting for the other side: %w", err)
+	}
+	peer, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return nil, errBadPakeMessage
+	}
+	return s.finish(peer)
+}
+
+func (m *mailbox) path() string {
+	return "/mailbox/" + strconv.Itoa(m.nameplate)
+}
+
+func (m *mailbox) post(phase, body string) error {
+	err := m.c.postJSON(m.path()+"/messages", mailboxMessage{Side: m.side, Phase: phase, Body: body}, nil)
+	if err != nil {
+		return fmt.Errorf("posting to mailbox: %w", err)
+	}
+	return nil
+}
+
+func (m *mailbox) postSealed(key []byte, phase string, plaintext []byte) error {
+	sealed, err := seal(key, plaintext)
+	if err != nil {
+		return err
+	}
+	return m.post(phase, base64.RawURLEncoding.EncodeToString(sealed))
+}
+
+// waitFor long-polls until the other side posts a message in phase and
+// returns its body
+func (m *mailbox) waitFor(phase string) (string, error) {
+	for time.Now().Before(m.deadline) {
+		query := url.Values{"after": {strconv.FormatInt(m.next, 10)}, "wait": {strconv.Itoa(mailboxWait)}}
+		resp, err := m.c.HTTP.Get(m.c.BaseURL + m.path() + "/messages?" + query.Encode())
+		if err != nil {
+			return "", err
+		}
+		var page struct {
+			Messages []mailboxMessage `json:"messages"`
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			err = errMailboxClosed
+		} else if resp.StatusCode != http.StatusOK {
+			err = responseError(resp)
+		} else {
+			err = json.NewDecoder(resp.Body).Decode(&page)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		// Later messages may belong to the next phase, so only skip past
+		// the ones read here
+		for _, msg := range page.Messages {
+			m.next++
+			if msg.Side != m.side && msg.Phase == phase {
+				return msg.Body, nil
+			}
+		}
+	}
+	return "", errors.New("timed out")
+}
+
+// close frees the nameplate. It is best effort: the mailbox expires anyway.
+func (m *mailbox) close() {
+	req, err := http.NewRequest(http.MethodDelete, m.c.BaseURL+m.path()+"?side="+m.side, nil)
+	if err != nil {
+		return
+	}
+	if resp, err := m.c.HTTP.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+func (c *Client) postJSON(path string, body, result any) error {
+	var payload io.Reader = http.NoBody
+	if body != nil {
+		u, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(u)
+	}
+	resp, err := c.HTTP.Post(c.BaseURL+path, "application/json", payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return responseError(resp)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// seal encrypts plaintext under key as nonce followed by ciphertext
+func seal(key, plaintext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key, sealed []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("message too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// openSealed decrypts a mailbox message body posted with postSealed
+func openSealed(key []byte, body string) ([]byte, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return nil, err
+	}
+	return open(key, sealed)
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"bytes"
+	"testing"
+)
+
+// exchange runs both sides of SPAKE2 and returns their keys
+func exchange(t *testing.T, codeA, codeB string) ([]byte, []byte) {
+	t.Helper()
+	a, err := newSpake(spakeA, codeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newSpake(spakeB, codeB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyA, err := a.finish(b.msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyB, err := b.finish(a.msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyA, keyB
+}
+
+func TestSpakeSameCode(t *testing.T) {
+	keyA, keyB := exchange(t, "7-guitar-orbit", "7-guitar-orbit")
+	if !bytes.Equal(keyA, keyB) {
+		t.Fatal("sides with the same code derived different keys")
+	}
+	again, _ := exchange(t, "7-guitar-orbit", "7-guitar-orbit")
+	if bytes.Equal(keyA, again) {
+		t.Error("two exchanges derived the same key")
+	}
+}
+
+func TestSpakeWrongCode(t *testing.T) {
+	keyA, keyB := exchange(t, "7-guitar-orbit", "7-guitar-orbil")
+	if bytes.Equal(keyA, keyB) {
+		t.Fatal("sides with different codes derived the same key")
+	}
+}
+
+func TestSpakeRejectsBadMessage(t *testing.T) {
+	s, err := newSpake(spakeA, "7-guitar-orbit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, peer := range [][]byte{nil, make([]byte, 32), bytes.Repeat([]byte{0xff}, 32)} {
+		if _, err := s.finish(peer); err != errBadPakeMessage {
+			t.Errorf("finish(%x) = %v, want errBadPakeMessage", peer, err)
+		}
+	}
+}
+
+func TestSealRoundTrip(t *testing.T) {
+	keyA, keyB := exchange(t, "12-apple-zebra", "12-apple-zebra")
+	sealed, err := seal(keyA, []byte("file contents"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := open(keyB, sealed)
+	if err != nil || string(got) != "file contents" {
+		t.Fatalf("open = %q, %v", got, err)
+	}
+
+	wrongA, _ := exchange(t, "12-apple-zebra", "12-apple-zebrb")
+	if _, err := open(wrongA, sealed); err == nil {
+		t.Error("opened with a key from another exchange")
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := open(keyB, sealed); err == nil {
+		t.Error("opened a tampered message")
+	}
+}
@@ -0,0 +1,203 @@
+// Command fileorcha uploads and downloads self-destructing files from the
+// command line, and sends files end-to-end encrypted with short codes. It
+// solves the server's proof-of-work challenges on its own.
+//
+//	fileorcha upload [-downloads n] [-expiry minutes] [-password p] FILE
+//	fileorcha download [-password p] [-otp code] [-o path] ID|URL
+//	fileorcha send FILE
+//	fileorcha receive [-o path] CODE
+//
+// The server is taken from -server or FILEORCHA_URL, and defaults to
+// http://localhost:8000.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Morizz00/self-destruct-share-api/client"
+)
+
+const usage = `usage: fileorcha [-server url] <command> [flags] [args]
+
+commands:
+  upload FILE      upload a file and print its link
+  download ID|URL  download a file
+  send FILE        send a file end-to-end encrypted with a short code
+  receive CODE     receive a file sent with a short code
+`
+
+func main() {
+	server := flag.String("server", defaultServer(), "server base URL")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := client.New(*server)
+	var err error
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "upload":
+		err = upload(c, args)
+	case "download":
+		err = download(c, args)
+	case "send":
+		err = send(c, args)
+	case "receive":
+		err = receive(c, args)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fileorcha:", err)
+		os.Exit(1)
+	}
+}
+
+func defaultServer() string {
+	if server := os.Getenv("FILEORCHA_URL"); server != "" {
+		return server
+	}
+	return "http://localhost:8000"
+}
+
+func upload(c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("upload", flag.ExitOnError)
+	var opts client.UploadOptions
+	fs.IntVar(&opts.Downloads, "downloads", 0, "number of downloads allowed (server default: 1)")
+	fs.IntVar(&opts.Expiry, "expiry", 0, "expiry in minutes (server default: 5)")
+	fs.StringVar(&opts.Password, "password", "", "password downloaders must give")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("upload takes one file")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	result, err := c.Upload(filepath.Base(f.Name()), f, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Println(c.BaseURL + "/download.html?id=" + result.ID)
+	fmt.Fprintf(os.Stderr, "id %s, %d downloads left, expires %s\n", result.ID, result.DownloadsLeft, result.ExpiresAt)
+	return nil
+}
+
+func download(c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("download", flag.ExitOnError)
+	var opts client.DownloadOptions
+	fs.StringVar(&opts.Password, "password", "", "file password")
+	fs.StringVar(&opts.OTP, "otp", "", "authenticator code")
+	out := fs.String("o", "", `output path, "-" for stdout (default: the file's name)`)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("download takes one id or link")
+	}
+
+	d, err := c.Download(fileID(fs.Arg(0)), opts)
+	if err != nil {
+		return err
+	}
+	defer d.Body.Close()
+	if *out == "-" {
+		_, err = io.Copy(os.Stdout, d.Body)
+		return err
+	}
+	name := *out
+	if name == "" {
+		name = d.FileName
+	}
+	if err := writeNew(name, d.Body); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "saved %s, %s downloads left\n", name, d.DownloadsLeft)
+	return nil
+}
+
+func send(c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("send takes one file")
+	}
+
+	content, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	err = c.Send(filepath.Base(fs.Arg(0)), content, func(code string) {
+		fmt.Fprintf(os.Stderr, "On the other computer, run:\n\n\tfileorcha receive %s\n\nWaiting for the receiver...\n", code)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "sent")
+	return nil
+}
+
+func receive(c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("receive", flag.ExitOnError)
+	out := fs.String("o", "", `output path, "-" for stdout (default: the file's name)`)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("receive takes one code")
+	}
+
+	name, content, err := c.Receive(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *out == "-" {
+		_, err = os.Stdout.Write(content)
+		return err
+	}
+	if *out != "" {
+		name = *out
+	}
+	if err := writeNew(name, bytes.NewReader(content)); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "saved %s\n", name)
+	return nil
+}
+
+// fileID accepts a bare id or any link the server hands out: the
+// download page (?id=) or /file/{id}
+func fileID(arg string) string {
+	u, err := url.Parse(arg)
+	if err != nil || u.Scheme == "" {
+		return arg
+	}
+	if id := u.Query().Get("id"); id != "" {
+		return id
+	}
+	return path.Base(strings.TrimSuffix(u.Path, "/"))
+}
+
+// writeNew copies r into a new file, refusing to overwrite one. A failed
+// download leaves nothing behind.
+func writeNew(name string, r io.Reader) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(name)
+		return err
+	}
+	return f.Close()
+}
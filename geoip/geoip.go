@@ -0,0 +1,92 @@
+package geoip
+
+import (
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+var (
+	mu     sync.RWMutex
+	reader *maxminddb.Reader
+)
+
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+// Load reads a MaxMind-format database from disk and swaps it in for
+// subsequent lookups. The file is read fully into memory so it can be
+// replaced on disk while the server is running.
+func Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	db, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	old := reader
+	reader = db
+	mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// Watch reloads the database whenever the file's modification time
+// changes. It runs until the process exits.
+func Watch(path string, interval time.Duration) {
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+	for range time.Tick(interval) {
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().After(lastMod) {
+			continue
+		}
+		lastMod = info.ModTime()
+		if err := Load(path); err != nil {
+			log.Printf("GeoIP reload failed: path=%s, error=%v", path, err)
+			continue
+		}
+		log.Printf("GeoIP database reloaded: path=%s", path)
+	}
+}
+
+// Enabled reports whether a database has been loaded
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return reader != nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 code for ip, or an empty string
+// when no database is loaded or the address is unknown
+func Country(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if reader == nil {
+		return ""
+	}
+	var record countryRecord
+	if err := reader.Lookup(ip, &record); err != nil {
+		return ""
+	}
+	return record.Country.ISOCode
+}
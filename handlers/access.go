@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Morizz00/self-destruct-share-api/geoip"
+	"github.com/Morizz00/self-destruct-share-api/storage"
+	"github.com/Morizz00/self-destruct-share-api/utils"
+)
+
+// ipAllowed reports whether the requesting client is inside the file's
+// allowed CIDR ranges. Files without restrictions allow everyone.
+func ipAllowed(r *http.Request, storedData storage.StoredFile) bool {
+	if len(storedData.AllowCIDRs) == 0 {
+		return true
+	}
+	nets, err := utils.ParseCIDRs(strings.Join(storedData.AllowCIDRs, ","))
+	if err != nil {
+		return false
+	}
+	return utils.ContainsIP(nets, utils.RequestIP(r))
+}
+
+// requestTokenAllowed reports whether a file received through a file
+// request is being accessed with the requester's owner token
+func requestTokenAllowed(r *http.Request, storedData storage.StoredFile) bool {
+	if storedData.RequestToken == "" {
+		return true
+	}
+	hash := utils.HashToken(r.URL.Query().Get("token"))
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(storedData.RequestToken)) == 1
+}
+
+// ownerTokenAllowed reports whether the request carries the uploader's
+// owner token, or the requester's token for files received through a file
+// request
+func ownerTokenAllowed(r *http.Request, storedData storage.StoredFile) bool {
+	hash := []byte(utils.HashToken(r.URL.Query().Get("token")))
+	for _, owner := range []string{storedData.OwnerToken, storedData.RequestToken} {
+		if owner != "" && subtle.ConstantTimeCompare(hash, []byte(owner)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// emailVerified reports whether a file limited to verified email addresses
+// is being accessed with an access token issued for it
+func emailVerified(r *http.Request, id string, storedData storage.StoredFile) bool {
+	if len(storedData.VerifyEmails) == 0 {
+		return true
+	}
+	token := r.URL.Query().Get("access_token")
+	if token == "" {
+		return false
+	}
+	fileID, err := storage.GetAccessToken(utils.HashToken(token))
+	return err == nil && fileID == id
+}
+
+// countryAllowed reports whether the requesting client resolves to one of
+// the file's allowed countries. Lookups fail closed: an unknown country or
+// a missing database denies access to geo-fenced files.
+func countryAllowed(r *http.Request, storedData storage.StoredFile) bool {
+	if len(storedData.AllowCountries) == 0 {
+		return true
+	}
+	country := geoip.Country(utils.RequestIP(r))
+	if country == "" {
+		return false
+	}
+	for _, allowed := range storedData.AllowCountries {
+		if strings.EqualFold(allowed, country) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSchedule enforces the embargo and daily access window. It returns
+// zero when the file is currently available, otherwise the status code and
+// message to send.
+func checkSchedule(storedData storage.StoredFile, now time.Time) (int, string) {
+	if now.Before(storedData.AvailableFrom) {
+		return http.StatusTooEarly, "File is not available until " + storedData.AvailableFrom.UTC().Format(time.RFC3339)
+	}
+	if storedData.AccessWindow != "" {
+		window, err := utils.ParseAccessWindow(storedData.AccessWindow, storedData.AccessTimezone)
+		if err != nil || !window.Contains(now) {
+			return http.StatusForbidden, "File can only be accessed between " + storedData.AccessWindow
+		}
+	}
+	return 0, ""
+}
+
+const (
+	maxTOTPFailures = 10
+	totpLockout     = 15 * time.Minute
+)
+
+// checkTOTP enforces the TOTP second factor without using up the code, so
+// a preview followed by a download works with one code. It returns zero
+// when the file has no second factor or the code is current and unused,
+// otherwise the status code and message to send.
+func checkTOTP(r *http.Request, id string, storedData storage.StoredFile) (int, string) {
+	if storedData.TOTPSecret == "" {
+		return 0, ""
+	}
+	// Failures count per address, so guessing can't lock out the real
+	// recipients
+	failures, err := storage.TOTPFailures(id, r.RemoteAddr)
+	if err != nil {
+		log.Printf("TOTP error: failed to read attempts: id=%s, error=%v", id, err)
+		return http.StatusInternalServerError, "Failed to check authenticator code"
+	}
+	if failures >= maxTOTPFailures {
+		return http.StatusTooManyRequests, "Too many wrong authenticator codes, try again later"
+	}
+	step, ok := utils.CheckTOTP(storedData.TOTPSecret, r.URL.Query().Get("otp"), time.Now())
+	if !ok {
+		if err := storage.RecordTOTPFailure(id, r.RemoteAddr, totpLockout); err != nil {
+			log.Printf("TOTP error: failed to record attempt: id=%s, error=%v", id, err)
+		}
+		return http.StatusForbidden, "Wrong, missing or reused authenticator code"
+	}
+	used, err := storage.TOTPStepUsed(id, step)
+	if err != nil {
+		log.Printf("TOTP error: failed to check code: id=%s, error=%v", id, err)
+		return http.StatusInternalServerError, "Failed to check authenticator code"
+	}
+	if used {
+		return http.StatusForbidden, "Wrong, missing or reused authenticator code"
+	}
+	return 0, ""
+}
+
+// useTOTPCode marks the request's TOTP code as used once a download is
+// charged. It reports false if another download used the code first.
+func useTOTPCode(r *http.Request, id string, storedData storage.StoredFile) (bool, error) {
+	if storedData.TOTPSecret == "" {
+		return true, nil
+	}
+	step, ok := utils.CheckTOTP(storedData.TOTPSecret, r.URL.Query().Get("otp"), time.Now())
+	if !ok {
+		return false, nil
+	}
+	return storage.UseTOTPStep(id, step, 3*utils.TOTPPeriod)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/Morizz00/self-destruct-share-api/storage"
+	"github.com/Morizz00/self-destruct-share-api/utils"
+)
+
+const maxBundleMembers = 100
+
+// BundleEntry describes a bundle member without its contents
+type BundleEntry struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+	MIME string `json:"mime"`
+}
+
+// bundleEntries lists the members of a bundle for previews
+func bundleEntries(storedData storage.StoredFile) []BundleEntry {
+	entries := make([]BundleEntry, 0, len(storedData.Members))
+	for _, m := range storedData.Members {
+		entries = append(entries, BundleEntry{Name: m.Name, Size: len(m.Data), MIME: m.MIME})
+	}
+	return entries
+}
+
+// readBundle reads every uploaded file into bundle members. paths holds
+// the optional relative path of each file (from folder uploads) in the
+// same order as files.
+func readBundle(files []*multipart.FileHeader, paths []string) ([]storage.BundleMember, error) {
+	if len(files) > maxBundleMembers {
+		return nil, fmt.Errorf("a bundle can contain at most %d files", maxBundleMembers)
+	}
+
+	var total int64
+	seen := make(map[string]bool, len(files))
+	members := make([]storage.BundleMember, 0, len(files))
+	for i, fh := range files {
+		total += fh.Size
+		if err := utils.ValidateFileSize(total); err != nil {
+			return nil, err
+		}
+
+		name := fh.Filename
+		if i < len(paths) && paths[i] != "" {
+			name = paths[i]
+		}
+		name = sanitizeBundlePath(name)
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate file %q in bundle", name)
+		}
+		seen[name] = true
+
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, storage.BundleMember{
+			Name: name,
+			MIME: fh.Header.Get("Content-Type"),
+			Data: data,
+		})
+	}
+	return members, nil
+}
+
+// sanitizeBundlePath cleans a relative upload path so it can neither
+// escape the archive root nor carry unsafe file names
+func sanitizeBundlePath(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	var parts []string
+	for _, part := range strings.Split(path.Clean("/"+name), "/") {
+		if part == "" || part == "." || part == ".." {
+			continue
+		}
+		parts = append(parts, utils.SanitizeFilename(part))
+	}
+	if len(parts) == 0 {
+		return "file"
+	}
+	return strings.Join(parts, "/")
+}
+
+// writeBundleZip streams the bundle as a ZIP archive built on the fly
+func writeBundleZip(w http.ResponseWriter, id string, storedData storage.StoredFile) {
+	w.Header().Set("Content-Disposition", "attachment; filename="+storedData.FileName)
+	w.Header().Set("Content-Type", "application/zip")
+
+	zw := zip.NewWriter(w)
+	for _, m := range storedData.Members {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     m.Name,
+			Method:   zip.Deflate,
+			Modified: storedData.CreatedAt.UTC(),
+		})
+		if err == nil {
+			_, err = fw.Write(m.Data)
+		}
+		if err != nil {
+			log.Printf("Download error: failed to stream bundle: id=%s, error=%v", id, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("Download error: failed to finish bundle: id=%s, error=%v", id, err)
+	}
+}
+
+// bundleFileName picks the download name of a bundle's ZIP
+func bundleFileName(requested string) string {
+	if strings.TrimSpace(requested) == "" {
+		return "bundle.zip"
+	}
+	return strings.TrimSuffix(utils.SanitizeFilename(requested), ".zip") + ".zip"
+}
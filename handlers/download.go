@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/Morizz00/self-destruct-share-api/storage"
 	"github.com/Morizz00/self-destruct-share-api/utils"
@@ -10,46 +13,160 @@ import (
 )
 
 func DownloadFile(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	storedData, err := storage.Get(id)
+	id, storedData, recipient, ok := authorizeDownload(w, r, chi.URLParam(r, "id"), "")
+	if !ok {
+		return
+	}
+	if !consumeAndSave(w, r, id, &storedData, recipient) {
+		return
+	}
+	if storedData.IsBundle() {
+		writeBundleZip(w, id, storedData)
+		return
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename="+storedData.FileName)
+	w.Header().Set("Content-Type", storedData.MIME)
+	w.Write(storedData.Data)
+}
+
+// DownloadBundleMember serves a single file out of a bundle. It counts
+// against the bundle's download budget like a full download.
+func DownloadBundleMember(w http.ResponseWriter, r *http.Request) {
+	id, storedData, recipient, ok := authorizeDownload(w, r, chi.URLParam(r, "id"), "")
+	if !ok {
+		return
+	}
+	name := chi.URLParam(r, "*")
+	member, found := storedData.Member(name)
+	if !found {
+		log.Printf("Download error: bundle member not found: id=%s, name=%s", id, name)
+		http.Error(w, "File not found in bundle", http.StatusNotFound)
+		return
+	}
+	if !consumeAndSave(w, r, id, &storedData, recipient) {
+		return
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename="+utils.SanitizeFilename(member.Name))
+	w.Header().Set("Content-Type", member.MIME)
+	w.Write(member.Data)
+}
+
+// authorizeDownload loads the file behind ref and runs every check that
+// must pass before a download is charged. Entries of a different kind are
+// reported as missing so files and secrets can't be read through each
+// other's endpoints. It writes the error response itself and returns
+// ok=false when the request is refused.
+func authorizeDownload(w http.ResponseWriter, r *http.Request, ref, kind string) (string, storage.StoredFile, *storage.Recipient, bool) {
+	id, storedData, recipient, err := loadFile(ref)
+	if err == nil && storedData.Kind != kind {
+		err = errWrongKind
+	}
+	if err == nil && !requestTokenAllowed(r, storedData) {
+		err = errNotRequester
+	}
 	if err != nil {
 		log.Printf("Download error: file not found: id=%s, error=%v", id, err)
 		http.Error(w, "File not found or expired", http.StatusNotFound)
-		return
+		return id, storedData, nil, false
+	}
+	if requiresRecipient(storedData, recipient) {
+		log.Printf("Download error: recipient link required: id=%s", id)
+		http.Error(w, "This file can only be downloaded through a recipient link", http.StatusForbidden)
+		return id, storedData, nil, false
+	}
+	if !emailVerified(r, id, storedData) {
+		log.Printf("Download error: email not verified: id=%s", id)
+		http.Error(w, "Verify your email address to download this file", http.StatusUnauthorized)
+		return id, storedData, nil, false
+	}
+	if !ipAllowed(r, storedData) {
+		log.Printf("Download error: address not allowed: id=%s, ip=%s", id, r.RemoteAddr)
+		http.Error(w, "Access from your network is not allowed", http.StatusForbidden)
+		return id, storedData, nil, false
+	}
+	if !countryAllowed(r, storedData) {
+		log.Printf("Download error: country not allowed: id=%s, ip=%s", id, r.RemoteAddr)
+		http.Error(w, "Access from your country is not allowed", http.StatusForbidden)
+		return id, storedData, nil, false
+	}
+	if status, msg := checkSchedule(storedData, time.Now()); status != 0 {
+		log.Printf("Download error: outside availability: id=%s, status=%d", id, status)
+		http.Error(w, msg, status)
+		return id, storedData, nil, false
 	}
-	fileData := storedData.Data
 	password := r.URL.Query().Get("password")
-	if storedData.Password != "" {
-		if !utils.CheckPassword(password, storedData.Password) {
+	if hash := passwordHash(storedData, recipient); hash != "" {
+		if !utils.CheckPassword(password, hash) {
 			log.Printf("Download error: wrong password: id=%s", id)
+			notify(id, storedData, recipient, storage.EventPasswordFailed)
 			http.Error(w, "Wrong or missing password", http.StatusForbidden)
-			return
+			return id, storedData, nil, false
 		}
 	}
-	if storedData.DownloadsLeft <= 0 {
+	if status, msg := checkTOTP(r, id, storedData); status != 0 {
+		log.Printf("Download error: authenticator code rejected: id=%s, status=%d", id, status)
+		if status == http.StatusForbidden {
+			notify(id, storedData, recipient, storage.EventPasswordFailed)
+		}
+		http.Error(w, msg, status)
+		return id, storedData, nil, false
+	}
+	if downloadsLeft(storedData, recipient) <= 0 {
 		log.Printf("Download error: no downloads remaining: id=%s", id)
 		http.Error(w, "No downloads remaining", http.StatusGone)
-		return
+		return id, storedData, nil, false
 	}
-	if storedData.DownloadsLeft == 1 {
-		err := storage.Delete(id)
-		if err != nil {
-			log.Printf("Download error: failed to delete file: id=%s, error=%v", id, err)
-			http.Error(w, "Failed to self-destruct file", http.StatusInternalServerError)
-			return
-		}
+	return id, storedData, recipient, true
+}
+
+// consumeAndSave charges one download and either self-destructs the file
+// or stores the new count. The authenticator code, if any, is used up
+// here. On success the download headers are set and the caller writes the
+// body.
+func consumeAndSave(w http.ResponseWriter, r *http.Request, id string, storedData *storage.StoredFile, recipient *storage.Recipient) bool {
+	fresh, err := useTOTPCode(r, id, *storedData)
+	if err != nil {
+		log.Printf("Download error: failed to use authenticator code: id=%s, error=%v", id, err)
+		http.Error(w, "Failed to check authenticator code", http.StatusInternalServerError)
+		return false
+	}
+	if !fresh {
+		log.Printf("Download error: reused one-time code: id=%s", id)
+		http.Error(w, "Wrong, missing or reused authenticator code", http.StatusForbidden)
+		return false
+	}
+	key := recipientKey(*storedData, recipient)
+	destroyed, err := storage.UpdateFileAfterAccess(id, storedData, func(file *storage.StoredFile) error {
+		return consumeDownload(file, key)
+	})
+	if errors.Is(err, storage.ErrNoDownloadsLeft) {
+		log.Printf("Download error: no downloads remaining: id=%s", id)
+		http.Error(w, "No downloads remaining", http.StatusGone)
+		return false
+	}
+	if errors.Is(err, storage.ErrFileGone) {
+		http.Error(w, "File not found or expired", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		log.Printf("Download error: failed to update download count: id=%s, error=%v", id, err)
+		http.Error(w, "Failed to update download count", http.StatusInternalServerError)
+		return false
+	}
+	// storedData is the freshly stored copy, so look the recipient up again
+	if key != "" {
+		recipient = storedData.Recipients[key]
+		log.Printf("Recipient download: id=%s, recipient=%s, recipient downloads left=%d", id, recipient.Label, recipient.DownloadsLeft)
+	}
+	if destroyed {
 		log.Printf("File self-destructed after download: id=%s", id)
+		notify(id, *storedData, recipient, storage.EventDownloaded)
+		notify(id, *storedData, recipient, storage.EventDestroyed)
 	} else {
-		storedData.DownloadsLeft--
-		err := storage.UpdateFilePreservingTTL(id, storedData)
-		if err != nil {
-			log.Printf("Download error: failed to update download count: id=%s, error=%v", id, err)
-			http.Error(w, "Failed to update download count", http.StatusInternalServerError)
-			return
-		}
 		log.Printf("File downloaded: id=%s, downloads left=%d", id, storedData.DownloadsLeft)
+		notify(id, *storedData, recipient, storage.EventDownloaded)
 	}
-	w.Header().Set("Content-Disposition", "attachment; filename="+storedData.FileName)
-	w.Header().Set("Content-Type", storedData.MIME)
-	w.Write(fileData)
+	w.Header().Set("X-Expires-At", formatTimestamp(storedData.ExpiresAt))
+	w.Header().Set("X-Downloads-Left", strconv.Itoa(downloadsLeft(*storedData, recipient)))
+	return true
 }
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Morizz00/self-destruct-share-api/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// eventsHeartbeat keeps idle streams open through proxies
+const eventsHeartbeat = 15 * time.Second
+
+// notify publishes a file event. Failures are logged and otherwise
+// ignored; events never block a download.
+func notify(id string, storedData storage.StoredFile, recipient *storage.Recipient, eventType string) {
+	event := storage.Event{
+		Type:          eventType,
+		FileID:        id,
+		DownloadsLeft: storedData.DownloadsLeft,
+		Time:          time.Now().UTC(),
+	}
+	if recipient != nil {
+		event.Recipient = recipient.Label
+	}
+	if err := storage.PublishEvent(event); err != nil {
+		log.Printf("Event error: failed to publish %s: id=%s, error=%v", eventType, id, err)
+	}
+}
+
+// FileEvents streams a file's events to its uploader as server-sent events
+// until the file is destroyed, revoked or expires
+func FileEvents(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	storedData, err := storage.Get(id)
+	if err != nil || !ownerTokenAllowed(r, storedData) {
+		http.Error(w, "File not found or expired", http.StatusNotFound)
+		return
+	}
+
+	sub, err := storage.SubscribeEvents(r.Context(), id)
+	if err != nil {
+		log.Printf("Event error: failed to subscribe: id=%s, error=%v", id, err)
+		http.Error(w, "Failed to follow file events", http.StatusInternalServerError)
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	send := func(format string, args ...any) bool {
+		rc.SetWriteDeadline(time.Now().Add(2 * eventsHeartbeat))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	if !send(": following %s\n\n", id) {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	messages := sub.Channel()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg := <-messages:
+			var event storage.Event
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				continue
+			}
+			if !send("event: %s\ndata: %s\n\n", event.Type, msg.Payload) {
+				return
+			}
+			if storage.IsFinalEvent(event.Type) {
+				return
+			}
+		case <-heartbeat.C:
+			if !send(": ping\n\n") {
+				return
+			}
+		}
+	}
+}
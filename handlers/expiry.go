@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/Morizz00/self-destruct-share-api/storage"
+)
+
+// fusePending reports whether the next access lights the file's fuse
+func fusePending(storedData storage.StoredFile) bool {
+	return storedData.Fuse > 0 && !storedData.FuseLit
+}
+
+// formatTimestamp renders t as RFC 3339 in UTC, or an empty string when t
+// is unset
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
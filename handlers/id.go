@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/Morizz00/self-destruct-share-api/utils"
+)
+
+// maxIDAttempts bounds how often a generated id that is already taken is
+// drawn again
+const maxIDAttempts = 3
+
+var (
+	errIDTaken  = errors.New("this custom link is already taken, try another one")
+	errNoFreeID = errors.New("no free id found")
+)
+
+// createWithID stores something new under slug, or under a generated id
+// when slug is empty. create must store atomically and report false when
+// the id is taken; generated ids are then drawn again, slugs fail with
+// errIDTaken.
+func createWithID(slug string, create func(id string) (bool, error)) (string, error) {
+	for attempt := 0; attempt < maxIDAttempts; attempt++ {
+		id := slug
+		if id == "" {
+			var err error
+			if id, err = utils.GenerateID(); err != nil {
+				return "", err
+			}
+		}
+		created, err := create(id)
+		if err != nil {
+			return "", err
+		}
+		if created {
+			return id, nil
+		}
+		if slug != "" {
+			return "", errIDTaken
+		}
+	}
+	return "", errNoFreeID
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/Morizz00/self-destruct-share-api/storage"
+	"github.com/Morizz00/self-destruct-share-api/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// Short-code transfers pair two clients through a mailbox. The code
+// "7-guitar-orbit" is the nameplate the server hands out plus words the
+// sender picks locally, so the server never learns the SPAKE2 password or
+// the key the clients derive from it. The file itself then goes through
+// /upload or /relay encrypted under that key.
+const (
+	mailboxExpiry      = 10 * time.Minute
+	maxNameplate       = 999
+	maxMailboxesPerIP  = 5
+	maxMailboxSides    = 2
+	maxMailboxMessages = 32
+	maxMailboxBody     = 16 * 1024
+	maxMailboxWait     = 30 * time.Second
+	mailboxPollEvery   = 500 * time.Millisecond
+)
+
+var (
+	mailboxSidePattern  = regexp.MustCompile(`^[a-z0-9]{1,32}$`)
+	mailboxPhasePattern = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+)
+
+type MailboxResponse struct {
+	Nameplate int    `json:"nameplate"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+type MailboxPost struct {
+	Side  string `json:"side"`
+	Phase string `json:"phase"`
+	Body  string `json:"body"`
+}
+
+type MailboxMessagesResponse struct {
+	Messages []storage.MailboxMessage `json:"messages"`
+	Next     int64                    `json:"next"`
+}
+
+// CreateMailbox allocates a nameplate for a new short-code transfer
+func CreateMailbox(w http.ResponseWriter, r *http.Request) {
+	// Nameplates are scarce, so one address can't hold many at once
+	created, err := storage.CountMailboxCreation(r.RemoteAddr, mailboxExpiry)
+	if err != nil {
+		log.Printf("Mailbox error: failed to count mailboxes: %v", err)
+		http.Error(w, "Failed to create mailbox", http.StatusInternalServerError)
+		return
+	}
+	if created > maxMailboxesPerIP {
+		http.Error(w, "Too many open transfers, try again later", http.StatusTooManyRequests)
+		return
+	}
+	mailbox, err := storage.AllocateMailbox(maxNameplate, mailboxExpiry)
+	if err == storage.ErrNoNameplate {
+		http.Error(w, "No codes available, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		log.Printf("Mailbox error: failed to allocate: %v", err)
+		http.Error(w, "Failed to create mailbox", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Mailbox created: nameplate=%d", mailbox.Nameplate)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(MailboxResponse{
+		Nameplate: mailbox.Nameplate,
+		ExpiresAt: formatTimestamp(mailbox.ExpiresAt),
+	})
+}
+
+// MailboxWords returns the word list clients pick code words from
+func MailboxWords(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	json.NewEncoder(w).Encode(utils.Words)
+}
+
+// PostMailboxMessage stores an opaque message from one of the two sides
+func PostMailboxMessage(w http.ResponseWriter, r *http.Request) {
+	mailbox, ok := loadMailbox(w, r)
+	if !ok {
+		return
+	}
+
+	var post MailboxPost
+	r.Body = http.MaxBytesReader(w, r.Body, maxMailboxBody+1024)
+	if err := json.NewDecoder(r.Body).Decode(&post); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if !mailboxSidePattern.MatchString(post.Side) || !mailboxPhasePattern.MatchString(post.Phase) {
+		http.Error(w, "Invalid side or phase", http.StatusBadRequest)
+		return
+	}
+	if len(post.Body) > maxMailboxBody {
+		http.Error(w, "Message too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	joined, err := storage.JoinMailbox(mailbox, post.Side, maxMailboxSides)
+	if err != nil {
+		log.Printf("Mailbox error: failed to join: nameplate=%d, error=%v", mailbox.Nameplate, err)
+		http.Error(w, "Failed to post message", http.StatusInternalServerError)
+		return
+	}
+	if !joined {
+		http.Error(w, "Mailbox already has two sides", http.StatusConflict)
+		return
+	}
+	count, err := storage.AppendMailboxMessage(mailbox, storage.MailboxMessage{
+		Side:      post.Side,
+		Phase:     post.Phase,
+		Body:      post.Body,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Mailbox error: failed to append: nameplate=%d, error=%v", mailbox.Nameplate, err)
+		http.Error(w, "Failed to post message", http.StatusInternalServerError)
+		return
+	}
+	if count > maxMailboxMessages {
+		// Too chatty to be a real transfer; close the mailbox
+		storage.DeleteMailbox(mailbox.Nameplate)
+		http.Error(w, "Too many messages, mailbox closed", http.StatusGone)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]int64{"count": count})
+}
+
+// GetMailboxMessages returns messages posted after the first "after" ones.
+// With "wait" (seconds) it long-polls until a new message arrives.
+func GetMailboxMessages(w http.ResponseWriter, r *http.Request) {
+	mailbox, ok := loadMailbox(w, r)
+	if !ok {
+		return
+	}
+	after, _ := strconv.ParseInt(r.URL.Query().Get("after"), 10, 64)
+	if after < 0 {
+		after = 0
+	}
+	wait, _ := strconv.Atoi(r.URL.Query().Get("wait"))
+	deadline := time.Now().Add(min(time.Duration(wait)*time.Second, maxMailboxWait))
+	// Long polls outlast the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(deadline.Add(10 * time.Second))
+
+	for {
+		messages, err := storage.MailboxMessages(mailbox.Nameplate, after)
+		if err != nil {
+			log.Printf("Mailbox error: failed to read: nameplate=%d, error=%v", mailbox.Nameplate, err)
+			http.Error(w, "Failed to read messages", http.StatusInternalServerError)
+			return
+		}
+		if len(messages) > 0 || !time.Now().Before(deadline) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			json.NewEncoder(w).Encode(MailboxMessagesResponse{
+				Messages: messages,
+				Next:     after + int64(len(messages)),
+			})
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(mailboxPollEvery):
+		}
+	}
+}
+
+// CloseMailbox frees the nameplate once the transfer is done. Only a side
+// that joined the mailbox can close it.
+func CloseMailbox(w http.ResponseWriter, r *http.Request) {
+	mailbox, ok := loadMailbox(w, r)
+	if !ok {
+		return
+	}
+	member, err := storage.IsMailboxSide(mailbox.Nameplate, r.URL.Query().Get("side"))
+	if err != nil || !member {
+		http.Error(w, "Mailbox not found", http.StatusNotFound)
+		return
+	}
+	if err := storage.DeleteMailbox(mailbox.Nameplate); err != nil {
+		log.Printf("Mailbox error: failed to delete: nameplate=%d, error=%v", mailbox.Nameplate, err)
+		http.Error(w, "Failed to close mailbox", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Mailbox closed: nameplate=%d", mailbox.Nameplate)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func loadMailbox(w http.ResponseWriter, r *http.Request) (storage.Mailbox, bool) {
+	nameplate, err := strconv.Atoi(chi.URLParam(r, "nameplate"))
+	if err != nil || nameplate < 1 || nameplate > maxNameplate {
+		http.Error(w, "Mailbox not found", http.StatusNotFound)
+		return storage.Mailbox{}, false
+	}
+	mailbox, err := storage.GetMailbox(nameplate)
+	if err != nil {
+		http.Error(w, "Mailbox not found", http.StatusNotFound)
+		return storage.Mailbox{}, false
+	}
+	return mailbox, true
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/Morizz00/self-destruct-share-api/storage"
+	"github.com/Morizz00/self-destruct-share-api/utils"
+)
+
+// messagesEnabled reports whether a sender message sealed under password
+// is accepted. Notes without a password are only as secret as
+// MESSAGE_KEY, so they are refused when it is unset.
+func messagesEnabled(password string) bool {
+	return password != "" || os.Getenv("MESSAGE_KEY") != ""
+}
+
+// messageSecret picks the key material for a file's sender message. With
+// a password the note can only be read by someone who knows it; otherwise
+// it is bound to the file id and the server-side MESSAGE_KEY.
+func messageSecret(id, password string) string {
+	if password != "" {
+		return password
+	}
+	return id + "\x00" + os.Getenv("MESSAGE_KEY")
+}
+
+// sealMessage sanitizes and encrypts a sender message for storage
+func sealMessage(id, password, message string) (string, error) {
+	message = utils.SanitizeMessage(message)
+	if message == "" {
+		return "", nil
+	}
+	return utils.SealText(message, messageSecret(id, password))
+}
+
+// openMessage decrypts the sender message of a file the caller has
+// already been authorized for. password is the file-level password
+// presented by the caller, if any.
+func openMessage(id string, storedData storage.StoredFile, password string) string {
+	if storedData.Message == "" {
+		return ""
+	}
+	if storedData.Password == "" || len(storedData.Recipients) > 0 {
+		password = ""
+	}
+	message, err := utils.OpenText(storedData.Message, messageSecret(id, password))
+	if err != nil {
+		return ""
+	}
+	return message
+}
+
+// metaMessage reveals a file's sender message on /meta to callers who
+// could open the file: the same recipient, email, network and country
+// checks as a download, then the password and authenticator code when the
+// file has them. Everyone else only learns that there is a message.
+func metaMessage(r *http.Request, id string, storedData storage.StoredFile, recipient *storage.Recipient) (string, bool) {
+	if requiresRecipient(storedData, recipient) || !emailVerified(r, id, storedData) ||
+		!ipAllowed(r, storedData) || !countryAllowed(r, storedData) {
+		return "", true
+	}
+	password := r.URL.Query().Get("password")
+	if hash := passwordHash(storedData, recipient); hash != "" {
+		if password == "" {
+			return "", true
+		}
+		if !utils.CheckPassword(password, hash) {
+			notify(id, storedData, recipient, storage.EventPasswordFailed)
+			return "", true
+		}
+	}
+	if storedData.TOTPSecret != "" {
+		// A missing code just keeps the message locked; only wrong codes
+		// count towards the lockout
+		if r.URL.Query().Get("otp") == "" {
+			return "", true
+		}
+		if status, _ := checkTOTP(r, id, storedData); status != 0 {
+			if status == http.StatusForbidden {
+				notify(id, storedData, recipient, storage.EventPasswordFailed)
+			}
+			return "", true
+		}
+	}
+	return openMessage(id, storedData, password), false
+}
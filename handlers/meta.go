@@ -12,21 +12,36 @@ import (
 )
 
 type MetaResponse struct {
-	Title         string `json:"title"`
-	Description   string `json:"description"`
-	Image         string `json:"image"`
-	URL           string `json:"url"`
-	Type          string `json:"type"`
-	SiteName      string `json:"site_name"`
-	FileSize      string `json:"file_size"`
-	FileType      string `json:"file_type"`
-	DownloadsLeft int    `json:"downloads_left"`
-	ExpiresAt     string `json:"expires_at"`
+	Title             string   `json:"title"`
+	Description       string   `json:"description"`
+	Image             string   `json:"image"`
+	URL               string   `json:"url"`
+	Type              string   `json:"type"`
+	SiteName          string   `json:"site_name"`
+	FileSize          string   `json:"file_size"`
+	FileType          string   `json:"file_type"`
+	DownloadsLeft     int      `json:"downloads_left"`
+	ExpiresAt         string   `json:"expires_at"`
+	CreatedAt         string   `json:"created_at,omitempty"`
+	LastAccessedAt    string   `json:"last_accessed_at,omitempty"`
+	DownloadCount     int      `json:"download_count"`
+	AvailableFrom     string   `json:"available_from,omitempty"`
+	AccessWindow      string   `json:"access_window,omitempty"`
+	FuseMinutes       int      `json:"fuse_minutes,omitempty"`
+	IdleMinutes       int      `json:"idle_minutes,omitempty"`
+	Message           string   `json:"message,omitempty"`
+	MessageLocked     bool     `json:"message_locked,omitempty"`
+	PGPKeys           []string `json:"pgp_keys,omitempty"`
+	EmailVerification bool     `json:"email_verification,omitempty"`
+	TOTPRequired      bool     `json:"totp_required,omitempty"`
 }
 
 func GetMeta(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	storedData, err := storage.Get(id)
+	fileID, storedData, recipient, err := loadFile(id)
+	if err == nil && !requestTokenAllowed(r, storedData) {
+		err = errNotRequester
+	}
 	if err != nil {
 		defaultMeta := MetaResponse{
 			Title:       "File Not Found - FileOrcha",
@@ -37,11 +52,14 @@ func GetMeta(w http.ResponseWriter, r *http.Request) {
 			SiteName:    "FileOrcha",
 		}
 		w.Header().Set("Content-Type", "application/json")
+		// Misses count as failed lookups for the proof-of-work difficulty
+		w.WriteHeader(http.StatusNotFound)
 		json.NewEncoder(w).Encode(defaultMeta)
 		return
 	}
 
-	if storedData.DownloadsLeft <= 0 {
+	left := downloadsLeft(storedData, recipient)
+	if left <= 0 {
 		defaultMeta := MetaResponse{
 			Title:       "File Expired - FileOrcha",
 			Description: "This file has no downloads remaining.",
@@ -55,9 +73,52 @@ func GetMeta(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if time.Now().Before(storedData.AvailableFrom) {
+		availableFrom := formatTimestamp(storedData.AvailableFrom)
+		pendingMeta := MetaResponse{
+			Title:         "File Not Yet Available - FileOrcha",
+			Description:   fmt.Sprintf("This file is not yet available. It will be released at %s.", availableFrom),
+			Image:         "https://via.placeholder.com/1200x630/6366f1/ffffff?text=Not+Yet+Available",
+			URL:           fmt.Sprintf("%s/download.html?id=%s", getBaseURL(r), id),
+			Type:          "website",
+			SiteName:      "FileOrcha",
+			ExpiresAt:     formatTimestamp(storedData.ExpiresAt),
+			CreatedAt:     formatTimestamp(storedData.CreatedAt),
+			AvailableFrom: availableFrom,
+			AccessWindow:  storedData.AccessWindow,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pendingMeta)
+		return
+	}
+
+	// Secrets link to a page that asks before revealing, since GET
+	// /secret/{id} uses up a view and link unfurlers would burn it
+	if storedData.Kind == storage.KindSecret {
+		secretMeta := MetaResponse{
+			Title:         "Secret Message - FileOrcha",
+			Description:   fmt.Sprintf("Someone shared a self-destructing secret with you • %d views left", left),
+			Image:         "https://via.placeholder.com/1200x630/3b82f6/ffffff?text=Secret+Message",
+			URL:           fmt.Sprintf("%s/secret.html?id=%s", getBaseURL(r), id),
+			Type:          "website",
+			SiteName:      "FileOrcha",
+			FileSize:      secretSizeHint(storedData.Size()),
+			FileType:      "Secret",
+			DownloadsLeft: left,
+			ExpiresAt:     formatTimestamp(storedData.ExpiresAt),
+			CreatedAt:     formatTimestamp(storedData.CreatedAt),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(secretMeta)
+		return
+	}
+
 	fileName := storedData.FileName
-	fileSize := formatFileSize(len(storedData.Data))
+	fileSize := formatFileSize(storedData.Size())
 	fileType := getFileTypeDisplay(storedData.MIME, fileName)
+	if storedData.IsBundle() {
+		fileType = fmt.Sprintf("Bundle (%d files)", len(storedData.Members))
+	}
 
 	title := fmt.Sprintf("%s - FileOrcha", fileName)
 	if len(title) > 60 {
@@ -65,28 +126,41 @@ func GetMeta(w http.ResponseWriter, r *http.Request) {
 	}
 
 	description := fmt.Sprintf("Download %s (%s) • %d downloads left • Self-destructing file",
-		fileName, fileSize, storedData.DownloadsLeft)
+		fileName, fileSize, left)
 	if len(description) > 160 {
 		description = fmt.Sprintf("Download %s • %d downloads left • Self-destructing file",
-			fileName, storedData.DownloadsLeft)
+			fileName, left)
 	}
 
 	previewImage := generatePreviewImage(fileName, fileType)
 
-	expiryTime := time.Now().Add(storedData.Expiry)
-	expiresAt := expiryTime.Format("2006-01-02 15:04:05 UTC")
-
 	meta := MetaResponse{
-		Title:         title,
-		Description:   description,
-		Image:         previewImage,
-		URL:           fmt.Sprintf("%s/download.html?id=%s", getBaseURL(r), id),
-		Type:          "website",
-		SiteName:      "FileOrcha",
-		FileSize:      fileSize,
-		FileType:      fileType,
-		DownloadsLeft: storedData.DownloadsLeft,
-		ExpiresAt:     expiresAt,
+		Title:             title,
+		Description:       description,
+		Image:             previewImage,
+		URL:               fmt.Sprintf("%s/download.html?id=%s", getBaseURL(r), id),
+		Type:              "website",
+		SiteName:          "FileOrcha",
+		FileSize:          fileSize,
+		FileType:          fileType,
+		DownloadsLeft:     left,
+		ExpiresAt:         formatTimestamp(storedData.ExpiresAt),
+		CreatedAt:         formatTimestamp(storedData.CreatedAt),
+		LastAccessedAt:    formatTimestamp(storedData.LastAccessedAt),
+		DownloadCount:     storedData.DownloadCount,
+		AccessWindow:      storedData.AccessWindow,
+		PGPKeys:           storedData.PGPKeys,
+		EmailVerification: len(storedData.VerifyEmails) > 0,
+		TOTPRequired:      storedData.TOTPSecret != "",
+	}
+	if fusePending(storedData) {
+		meta.FuseMinutes = int(storedData.Fuse / time.Minute)
+	}
+	if storedData.IdleTimeout > 0 {
+		meta.IdleMinutes = int(storedData.IdleTimeout / time.Minute)
+	}
+	if storedData.Message != "" {
+		meta.Message, meta.MessageLocked = metaMessage(r, fileID, storedData, recipient)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
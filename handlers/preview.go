@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/Morizz00/self-destruct-share-api/storage"
 	"github.com/Morizz00/self-destruct-share-api/utils"
@@ -11,46 +15,114 @@ import (
 )
 
 type PreviewRequest struct {
-	FileName      string `json:"filename"`
-	FileSize      int    `json:"filesize"`
-	MIME          string `json:"mime"`
-	DownloadsLeft int    `json:"downloadleft"`
-	HasPassword   bool   `json:"haspassword"`
-	FileData      string `json:"filedata,omitempty"`
+	FileName       string        `json:"filename"`
+	FileSize       int           `json:"filesize"`
+	MIME           string        `json:"mime"`
+	DownloadsLeft  int           `json:"downloadleft"`
+	HasPassword    bool          `json:"haspassword"`
+	FileData       string        `json:"filedata,omitempty"`
+	CreatedAt      string        `json:"created_at"`
+	ExpiresAt      string        `json:"expires_at"`
+	LastAccessedAt string        `json:"last_accessed_at,omitempty"`
+	DownloadCount  int           `json:"download_count"`
+	Files          []BundleEntry `json:"files,omitempty"`
+	Message        string        `json:"message,omitempty"`
 }
 
 func Preview(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	storedData, err := storage.Get(id)
+	id, storedData, recipient, err := loadFile(chi.URLParam(r, "id"))
+	if err == nil && storedData.Kind == storage.KindSecret {
+		err = errWrongKind
+	}
+	if err == nil && !requestTokenAllowed(r, storedData) {
+		err = errNotRequester
+	}
 	if err != nil {
 		http.Error(w, "File not found or expired", http.StatusNotFound)
 		return
 	}
+	if requiresRecipient(storedData, recipient) {
+		http.Error(w, "This file can only be previewed through a recipient link", http.StatusForbidden)
+		return
+	}
+	if !emailVerified(r, id, storedData) {
+		http.Error(w, "Verify your email address to preview this file", http.StatusUnauthorized)
+		return
+	}
+	if !ipAllowed(r, storedData) {
+		http.Error(w, "Access from your network is not allowed", http.StatusForbidden)
+		return
+	}
+	if !countryAllowed(r, storedData) {
+		http.Error(w, "Access from your country is not allowed", http.StatusForbidden)
+		return
+	}
+	if status, msg := checkSchedule(storedData, time.Now()); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
 	password := r.URL.Query().Get("password")
-	if storedData.Password != "" {
-		if !utils.CheckPassword(password, storedData.Password) {
+	if hash := passwordHash(storedData, recipient); hash != "" {
+		if !utils.CheckPassword(password, hash) {
+			notify(id, storedData, recipient, storage.EventPasswordFailed)
 			http.Error(w, "Wrong or missing password", http.StatusForbidden)
 			return
 		}
 	}
-	if storedData.DownloadsLeft <= 0 {
+	if status, msg := checkTOTP(r, id, storedData); status != 0 {
+		if status == http.StatusForbidden {
+			notify(id, storedData, recipient, storage.EventPasswordFailed)
+		}
+		http.Error(w, msg, status)
+		return
+	}
+	if downloadsLeft(storedData, recipient) <= 0 {
 		http.Error(w, "No downloads remaining", http.StatusGone)
 		return
 	}
+	key := recipientKey(storedData, recipient)
+	_, err = storage.UpdateFileAfterAccess(id, &storedData, nil)
+	if errors.Is(err, storage.ErrFileGone) {
+		http.Error(w, "File not found or expired", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Preview error: failed to record access: id=%s, error=%v", id, err)
+		http.Error(w, "Failed to update file", http.StatusInternalServerError)
+		return
+	}
+	if key != "" {
+		recipient = storedData.Recipients[key]
+	}
+	notify(id, storedData, recipient, storage.EventPreviewed)
 
 	response := PreviewRequest{
-		FileName:      storedData.FileName,
-		FileSize:      len(storedData.Data),
-		MIME:          storedData.MIME,
-		DownloadsLeft: storedData.DownloadsLeft,
-		HasPassword:   storedData.Password != "",
+		FileName:       storedData.FileName,
+		FileSize:       storedData.Size(),
+		MIME:           storedData.MIME,
+		DownloadsLeft:  downloadsLeft(storedData, recipient),
+		HasPassword:    passwordHash(storedData, recipient) != "",
+		CreatedAt:      formatTimestamp(storedData.CreatedAt),
+		ExpiresAt:      formatTimestamp(storedData.ExpiresAt),
+		LastAccessedAt: formatTimestamp(storedData.LastAccessedAt),
+		DownloadCount:  storedData.DownloadCount,
+		Message:        openMessage(id, storedData, password),
 	}
 
-	if len(storedData.Data) < 5*1024*1024 {
+	if storedData.IsBundle() {
+		response.Files = bundleEntries(storedData)
+	} else if len(storedData.Data) < 5*1024*1024 {
 		w.Header().Set("Content-Type", storedData.MIME)
 		w.Header().Set("X-File-Name", storedData.FileName)
 		w.Header().Set("X-File-Size", strconv.Itoa(len(storedData.Data)))
-		w.Header().Set("X-Downloads-Left", strconv.Itoa(storedData.DownloadsLeft))
+		w.Header().Set("X-Downloads-Left", strconv.Itoa(response.DownloadsLeft))
+		w.Header().Set("X-Created-At", response.CreatedAt)
+		w.Header().Set("X-Expires-At", response.ExpiresAt)
+		w.Header().Set("X-Last-Accessed-At", response.LastAccessedAt)
+		w.Header().Set("X-Download-Count", strconv.Itoa(storedData.DownloadCount))
+		if response.Message != "" {
+			w.Header().Set("X-Sender-Message", url.PathEscape(response.Message))
+		}
 		w.Write(storedData.Data)
 		return
 	}
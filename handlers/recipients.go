@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Morizz00/self-destruct-share-api/storage"
+	"github.com/Morizz00/self-destruct-share-api/utils"
+)
+
+const (
+	maxRecipients      = 20
+	maxRecipientLabel  = 64
+	recipientSeparator = "."
+)
+
+var (
+	errUnknownRecipient = errors.New("unknown recipient token")
+	errBadIDChecksum    = errors.New("id checksum mismatch")
+)
+
+// RecipientRequest is one entry of the "recipients" upload option
+type RecipientRequest struct {
+	Label     string `json:"label"`
+	Downloads int    `json:"downloads"`
+	Password  string `json:"password,omitempty"`
+}
+
+// RecipientLink is returned to the uploader for each recipient. The URL
+// embeds the recipient's secret and is only shown once.
+type RecipientLink struct {
+	Label     string `json:"label"`
+	URL       string `json:"url"`
+	Downloads int    `json:"downloads"`
+	token     string
+}
+
+// parseRecipients validates the JSON recipients option and generates a
+// token for each entry. It returns the entries to store, keyed by token
+// hash, and the links to hand back once the file id is known.
+func parseRecipients(raw string) (map[string]*storage.Recipient, []RecipientLink, error) {
+	var requests []RecipientRequest
+	if err := json.Unmarshal([]byte(raw), &requests); err != nil {
+		return nil, nil, fmt.Errorf("recipients must be a JSON array of {label, downloads, password}")
+	}
+	if len(requests) == 0 {
+		return nil, nil, nil
+	}
+	if len(requests) > maxRecipients {
+		return nil, nil, fmt.Errorf("at most %d recipients are allowed", maxRecipients)
+	}
+
+	recipients := make(map[string]*storage.Recipient, len(requests))
+	links := make([]RecipientLink, 0, len(requests))
+	for i, req := range requests {
+		label := strings.TrimSpace(req.Label)
+		if label == "" {
+			label = fmt.Sprintf("recipient-%d", i+1)
+		}
+		if len(label) > maxRecipientLabel {
+			return nil, nil, fmt.Errorf("recipient label %q is longer than %d characters", label, maxRecipientLabel)
+		}
+		if req.Downloads == 0 {
+			req.Downloads = 1
+		}
+		if err := utils.ValidateDownloads(req.Downloads); err != nil {
+			return nil, nil, fmt.Errorf("recipient %q: %w", label, err)
+		}
+		hashedPassword, err := utils.HashPassword(req.Password)
+		if err != nil {
+			return nil, nil, err
+		}
+		token, err := utils.GenerateToken(16)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		recipients[utils.HashToken(token)] = &storage.Recipient{
+			Label:         label,
+			Password:      hashedPassword,
+			DownloadsLeft: req.Downloads,
+		}
+		links = append(links, RecipientLink{Label: label, Downloads: req.Downloads, token: token})
+	}
+	return recipients, links, nil
+}
+
+// recipientRef builds the public reference for a recipient of file id
+func recipientRef(id, token string) string {
+	return id + recipientSeparator + token
+}
+
+// loadFile resolves a file id or recipient reference ("<id>.<token>") to
+// the stored file. recipient is nil for plain ids. Mistyped generated ids
+// are normalized, or rejected without a lookup when their checksum fails.
+func loadFile(ref string) (string, storage.StoredFile, *storage.Recipient, error) {
+	id, token, isRecipient := strings.Cut(ref, recipientSeparator)
+	normalized := utils.NormalizeID(id)
+	if normalized == "" {
+		return id, storage.StoredFile{}, nil, errBadIDChecksum
+	}
+	id = normalized
+	storedData, err := storage.Get(id)
+	if err != nil {
+		return id, storedData, nil, err
+	}
+	if !isRecipient {
+		return id, storedData, nil, nil
+	}
+	recipient, ok := storedData.Recipients[utils.HashToken(token)]
+	if !ok {
+		return id, storedData, nil, errUnknownRecipient
+	}
+	return id, storedData, recipient, nil
+}
+
+// requiresRecipient reports whether a file shared with named recipients
+// is being accessed without a recipient link
+func requiresRecipient(storedData storage.StoredFile, recipient *storage.Recipient) bool {
+	return len(storedData.Recipients) > 0 && recipient == nil
+}
+
+// passwordHash returns the password hash guarding this access: the
+// recipient's own password when it has one, the file's otherwise
+func passwordHash(storedData storage.StoredFile, recipient *storage.Recipient) string {
+	if recipient != nil && recipient.Password != "" {
+		return recipient.Password
+	}
+	return storedData.Password
+}
+
+// downloadsLeft returns the remaining budget for this access
+func downloadsLeft(storedData storage.StoredFile, recipient *storage.Recipient) int {
+	if recipient != nil {
+		return recipient.DownloadsLeft
+	}
+	return storedData.DownloadsLeft
+}
+
+// recipientKey returns the key recipient is stored under in the file, or
+// "" for plain ids
+func recipientKey(storedData storage.StoredFile, recipient *storage.Recipient) string {
+	for key, r := range storedData.Recipients {
+		if r == recipient {
+			return key
+		}
+	}
+	return ""
+}
+
+// consumeDownload charges one download to the recipient stored under key,
+// if any, and to the file. The file's own budget is the total of all
+// recipient budgets, so it reaches zero once every recipient is exhausted.
+// It runs on the freshly read file, so a spent budget fails with
+// storage.ErrNoDownloadsLeft.
+func consumeDownload(storedData *storage.StoredFile, key string) error {
+	if key != "" {
+		recipient, ok := storedData.Recipients[key]
+		if !ok || recipient.DownloadsLeft <= 0 {
+			return storage.ErrNoDownloadsLeft
+		}
+		recipient.DownloadsLeft--
+		recipient.DownloadCount++
+	}
+	if storedData.DownloadsLeft <= 0 {
+		return storage.ErrNoDownloadsLeft
+	}
+	storedData.DownloadsLeft--
+	storedData.DownloadCount++
+	return nil
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/Morizz00/self-destruct-share-api/storage"
+	"github.com/Morizz00/self-destruct-share-api/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// relayWaitTimeout is how long a sender waits for its receiver
+	relayWaitTimeout = 10 * time.Minute
+	// relayIdleTimeout is how long a transfer may stall on either side
+	relayIdleTimeout = time.Minute
+	relayChunkSize   = 32 * 1024
+)
+
+var relayIDPattern = regexp.MustCompile(`^[a-z0-9-]{1,64}$`)
+
+var (
+	errRelaySenderGone   = errors.New("sender disconnected")
+	errRelayReceiverGone = errors.New("receiver disconnected")
+)
+
+// relay is a sender blocked in RelaySend until a receiver claims it
+type relay struct {
+	storage.Relay
+	receiver chan *relayReceiver
+}
+
+// relayReceiver is handed to the sender, which streams into w and reports
+// the outcome on done. The receiving handler must not return before done.
+type relayReceiver struct {
+	ctx  context.Context
+	w    http.ResponseWriter
+	rc   *http.ResponseController
+	done chan error
+}
+
+// Relays pair up inside one process, so senders and receivers must reach
+// the same instance; the Redis record keeps ids unique across instances.
+var (
+	relaysMu sync.Mutex
+	relays   = map[string]*relay{}
+)
+
+// RelaySend streams the request body straight to the receiver of the same
+// id. It blocks until a receiver connects, the wait times out or the sender
+// goes away.
+func RelaySend(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !relayIDPattern.MatchString(id) {
+		http.Error(w, "Invalid relay id", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	record := storage.Relay{
+		FileName:  utils.SanitizeFilename(r.Header.Get("X-File-Name")),
+		MIME:      r.Header.Get("Content-Type"),
+		Size:      r.ContentLength,
+		CreatedAt: now,
+		ExpiresAt: now.Add(relayWaitTimeout),
+	}
+	if record.FileName == "" || record.FileName == "." {
+		record.FileName = "relay"
+	}
+	if record.MIME == "" {
+		record.MIME = "application/octet-stream"
+	}
+	if password := r.URL.Query().Get("password"); password != "" {
+		hash, err := utils.HashPassword(password)
+		if err != nil {
+			log.Printf("Relay error: failed to hash password: %v", err)
+			http.Error(w, "Failed to process password", http.StatusInternalServerError)
+			return
+		}
+		record.Password = hash
+	}
+
+	ok, err := storage.ReserveRelay(id, record, relayWaitTimeout)
+	if err != nil {
+		log.Printf("Relay error: failed to reserve: id=%s, error=%v", id, err)
+		http.Error(w, "Failed to open relay", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Relay id already in use", http.StatusConflict)
+		return
+	}
+	defer storage.DeleteRelay(id)
+
+	rel := &relay{Relay: record, receiver: make(chan *relayReceiver, 1)}
+	relaysMu.Lock()
+	relays[id] = rel
+	relaysMu.Unlock()
+
+	// The server's read and write timeouts are far shorter than the wait
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(now.Add(relayWaitTimeout + relayIdleTimeout))
+	rc.SetWriteDeadline(now.Add(relayWaitTimeout + relayIdleTimeout))
+	log.Printf("Relay opened: id=%s, filename=%s, size=%d", id, record.FileName, record.Size)
+
+	timer := time.NewTimer(relayWaitTimeout)
+	defer timer.Stop()
+	var recv *relayReceiver
+	select {
+	case recv = <-rel.receiver:
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+	if recv == nil {
+		relaysMu.Lock()
+		claimed := relays[id] != rel
+		delete(relays, id)
+		relaysMu.Unlock()
+		if !claimed {
+			log.Printf("Relay closed without receiver: id=%s", id)
+			http.Error(w, "No receiver connected in time", http.StatusRequestTimeout)
+			return
+		}
+		// A receiver claimed the relay as we gave up; let it go
+		recv = <-rel.receiver
+		if r.Context().Err() != nil {
+			recv.done <- errRelaySenderGone
+			return
+		}
+	}
+
+	written, err := relayCopy(recv, r.Body, rc)
+	recv.done <- err
+	switch err {
+	case nil:
+		log.Printf("Relay complete: id=%s, bytes=%d", id, written)
+		fmt.Fprintf(w, "File relayed--Bytes:%d\n", written)
+	case errRelayReceiverGone:
+		log.Printf("Relay error: receiver disconnected: id=%s, bytes=%d", id, written)
+		http.Error(w, "Receiver disconnected before the transfer completed", http.StatusGone)
+	default:
+		log.Printf("Relay error: sender disconnected: id=%s, bytes=%d", id, written)
+	}
+}
+
+// RelayReceive claims a waiting relay and streams the sender's file
+func RelayReceive(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	relaysMu.Lock()
+	rel := relays[id]
+	relaysMu.Unlock()
+	if rel == nil {
+		if _, err := storage.GetRelay(id); err == nil {
+			http.Error(w, "Relay sender is connected to another server", http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, "Relay not found", http.StatusNotFound)
+		return
+	}
+	if rel.Password != "" && !utils.CheckPassword(r.URL.Query().Get("password"), rel.Password) {
+		log.Printf("Relay error: wrong password: id=%s", id)
+		http.Error(w, "Wrong or missing password", http.StatusForbidden)
+		return
+	}
+
+	// Only one receiver gets the stream
+	relaysMu.Lock()
+	if relays[id] != rel {
+		relaysMu.Unlock()
+		http.Error(w, "Relay not found", http.StatusNotFound)
+		return
+	}
+	delete(relays, id)
+	relaysMu.Unlock()
+
+	w.Header().Set("Content-Disposition", "attachment; filename="+rel.FileName)
+	w.Header().Set("Content-Type", rel.MIME)
+	w.Header().Set("X-File-Name", rel.FileName)
+	w.Header().Set("Cache-Control", "no-store")
+	if rel.Size >= 0 {
+		w.Header().Set("Content-Length", fmt.Sprint(rel.Size))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	recv := &relayReceiver{ctx: r.Context(), w: w, rc: http.NewResponseController(w), done: make(chan error, 1)}
+	recv.rc.SetWriteDeadline(time.Now().Add(relayIdleTimeout))
+	recv.rc.Flush()
+	rel.receiver <- recv
+
+	// The sender writes to w until it reports back, even if we go away
+	if err := <-recv.done; err != nil {
+		// Abort the connection so a partial file isn't mistaken for a
+		// complete one
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// relayCopy streams src into the receiver, extending both sides' deadlines
+// as long as data keeps moving
+func relayCopy(recv *relayReceiver, src io.Reader, rc *http.ResponseController) (int64, error) {
+	buf := make([]byte, relayChunkSize)
+	var written int64
+	for {
+		rc.SetReadDeadline(time.Now().Add(relayIdleTimeout))
+		rc.SetWriteDeadline(time.Now().Add(2 * relayIdleTimeout))
+		n, err := src.Read(buf)
+		if n > 0 {
+			// Writes can still land in socket buffers after the receiver
+			// hangs up
+			if recv.ctx.Err() != nil {
+				return written, errRelayReceiverGone
+			}
+			recv.rc.SetWriteDeadline(time.Now().Add(relayIdleTimeout))
+			if _, werr := recv.w.Write(buf[:n]); werr != nil {
+				return written, errRelayReceiverGone
+			}
+			if ferr := recv.rc.Flush(); ferr != nil {
+				return written, errRelayReceiverGone
+			}
+			written += int64(n)
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, errRelaySenderGone
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Morizz00/self-destruct-share-api/storage"
+	"github.com/Morizz00/self-destruct-share-api/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+var errNotRequester = errors.New("file belongs to a file request")
+
+// maxRequestOptionsBody bounds the body of POST /request, which only holds
+// a few options and a public key
+const maxRequestOptionsBody = 16 * 1024
+
+// FileRequestOptions is the body of POST /request, sent as JSON or form
+// fields
+type FileRequestOptions struct {
+	Label      string `json:"label"`
+	Expiry     int    `json:"expiry"`
+	MaxUploads int    `json:"max_uploads"`
+	MaxSize    int64  `json:"max_size"`
+	Downloads  int    `json:"downloads"`
+	PublicKey  string `json:"public_key"`
+}
+
+// FileRequestResponse is returned once when a file request is created.
+// The owner token is not stored and can't be recovered.
+type FileRequestResponse struct {
+	ID          string `json:"id"`
+	UploadURL   string `json:"upload_url"`
+	FilesURL    string `json:"files_url"`
+	OwnerToken  string `json:"owner_token"`
+	UploadsLeft int    `json:"uploads_left"`
+	MaxSize     int64  `json:"max_size"`
+	PublicKey   string `json:"public_key,omitempty"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+// ReceivedFile describes a file uploaded through a file request
+type ReceivedFile struct {
+	ID            string `json:"id"`
+	URL           string `json:"url"`
+	FileName      string `json:"filename"`
+	FileSize      int    `json:"filesize"`
+	DownloadsLeft int    `json:"downloads_left"`
+	Sealed        bool   `json:"sealed,omitempty"`
+	CreatedAt     string `json:"created_at"`
+	ExpiresAt     string `json:"expires_at"`
+}
+
+// CreateRequest creates an inbox link that lets others upload files for
+// the caller without an account
+func CreateRequest(w http.ResponseWriter, r *http.Request) {
+	var opts FileRequestOptions
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestOptionsBody)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	} else {
+		opts.Label = r.FormValue("label")
+		opts.Expiry, _ = strconv.Atoi(r.FormValue("expiry"))
+		opts.MaxUploads, _ = strconv.Atoi(r.FormValue("max_uploads"))
+		opts.MaxSize, _ = strconv.ParseInt(r.FormValue("max_size"), 10, 64)
+		opts.Downloads, _ = strconv.Atoi(r.FormValue("downloads"))
+		opts.PublicKey = r.FormValue("public_key")
+	}
+
+	if opts.Expiry <= 0 {
+		opts.Expiry = 60 * 24
+	}
+	if err := utils.ValidateExpiry(opts.Expiry); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.MaxUploads <= 0 {
+		opts.MaxUploads = 1
+	}
+	if err := utils.ValidateRequestUploads(opts.MaxUploads); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = utils.MaxFileSize
+	}
+	if err := utils.ValidateFileSize(opts.MaxSize); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Downloads <= 0 {
+		opts.Downloads = 1
+	}
+	if err := utils.ValidateDownloads(opts.Downloads); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Drop box mode: everything received is sealed to this key
+	publicKey := ""
+	if opts.PublicKey != "" {
+		key, err := utils.ParsePublicKey(opts.PublicKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		publicKey = base64.StdEncoding.EncodeToString(key[:])
+	}
+
+	ownerToken, err := utils.GenerateToken(16)
+	if err != nil {
+		log.Printf("Request error: failed to generate token: %v", err)
+		http.Error(w, "Failed to create request", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	expiry := time.Duration(opts.Expiry) * time.Minute
+	req := storage.FileRequest{
+		Label:      utils.SanitizeMessage(opts.Label),
+		OwnerToken: utils.HashToken(ownerToken),
+		MaxUploads: opts.MaxUploads,
+		MaxSize:    opts.MaxSize,
+		Downloads:  opts.Downloads,
+		PublicKey:  publicKey,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(expiry),
+	}
+	id, err := createWithID("", func(id string) (bool, error) {
+		return storage.CreateRequest(id, req, expiry)
+	})
+	if err != nil {
+		log.Printf("Request error: storage failed: %v", err)
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("File request created: id=%s, uploads=%d, max size=%d, expiry=%v", id, opts.MaxUploads, opts.MaxSize, expiry)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(FileRequestResponse{
+		ID:          id,
+		UploadURL:   "/request/" + id + "/upload",
+		FilesURL:    "/request/" + id + "/files",
+		OwnerToken:  ownerToken,
+		UploadsLeft: req.MaxUploads,
+		MaxSize:     req.MaxSize,
+		PublicKey:   req.PublicKey,
+		ExpiresAt:   formatTimestamp(req.ExpiresAt),
+	})
+}
+
+// UploadToRequest accepts a file (or bundle) for a file request. Uploaded
+// files live as long as the request and can only be downloaded with the
+// requester's owner token.
+func UploadToRequest(w http.ResponseWriter, r *http.Request) {
+	requestID := chi.URLParam(r, "id")
+	req, err := storage.GetRequest(requestID)
+	if err != nil {
+		http.Error(w, "File request not found or expired", http.StatusNotFound)
+		return
+	}
+	// Checked again atomically once the upload is in; this only saves
+	// reading bodies for full requests
+	ttl := time.Until(req.ExpiresAt)
+	left, err := storage.RequestUploadsLeft(requestID, req)
+	if err != nil {
+		log.Printf("Request upload error: failed to count uploads: id=%s, error=%v", requestID, err)
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+	if left <= 0 || ttl <= 0 {
+		http.Error(w, "This file request is no longer accepting uploads", http.StatusGone)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, req.MaxSize+1024*1024)
+	content, err := readUploadedContent(r)
+	if err != nil {
+		log.Printf("Request upload error: id=%s, error=%v", requestID, err)
+		http.Error(w, uploadErrorMessage(err), http.StatusBadRequest)
+		return
+	}
+	if int64(content.size()) > req.MaxSize {
+		http.Error(w, "File exceeds the size limit of this request", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if r.FormValue("message") != "" && !messagesEnabled("") {
+		http.Error(w, "Messages are not available on this server", http.StatusBadRequest)
+		return
+	}
+	if req.PublicKey != "" {
+		if r.FormValue("message") != "" {
+			http.Error(w, "Messages are not supported by public-key requests, put the note inside the sealed file", http.StatusBadRequest)
+			return
+		}
+		if err := sealContent(&content, req.PublicKey, r.FormValue("sealed") == "true"); err != nil {
+			log.Printf("Request upload error: sealing failed: id=%s, error=%v", requestID, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	left, err = storage.ReserveRequestUpload(requestID, req)
+	if errors.Is(err, storage.ErrRequestFull) {
+		http.Error(w, "This file request is no longer accepting uploads", http.StatusGone)
+		return
+	}
+	if err != nil {
+		log.Printf("Request upload error: failed to reserve upload: id=%s, error=%v", requestID, err)
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	storeIt := storage.StoredFile{
+		FileName:      content.FileName,
+		MIME:          content.MIME,
+		Data:          content.Data,
+		Members:       content.Members,
+		DownloadsLeft: req.Downloads,
+		Expiry:        ttl,
+		MaxExpiresAt:  req.ExpiresAt,
+		CreatedAt:     now,
+		ExpiresAt:     req.ExpiresAt,
+		RequestToken:  req.OwnerToken,
+		Sealed:        req.PublicKey != "",
+	}
+	id, err := createWithID("", func(id string) (bool, error) {
+		sealed, err := sealMessage(id, "", r.FormValue("message"))
+		if err != nil {
+			return false, err
+		}
+		storeIt.Message = sealed
+		return storage.CreateFile(id, storeIt, ttl)
+	})
+	if err != nil {
+		log.Printf("Request upload error: storage failed: %v", err)
+		storage.ReleaseRequestUpload(requestID)
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+	if err := storage.AddRequestFile(requestID, id, req); err != nil {
+		log.Printf("Request upload error: failed to update request: id=%s, error=%v", requestID, err)
+		storage.Delete(id)
+		storage.ReleaseRequestUpload(requestID)
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+	notify(id, storeIt, nil, storage.EventUploaded)
+	log.Printf("File received for request: request=%s, id=%s, size=%d, sealed=%t, uploads left=%d",
+		requestID, id, content.size(), storeIt.Sealed, left)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":           id,
+		"uploads_left": left,
+	})
+}
+
+// sealContent makes sure every payload of a drop box upload is sealed to
+// the requester's public key. Payloads the client already sealed are only
+// checked; everything else is sealed here before it reaches storage.
+func sealContent(content *uploadedContent, publicKey string, clientSealed bool) error {
+	key, err := utils.ParsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	return content.encrypt(".sealed", "application/octet-stream", func(_ string, data []byte) ([]byte, error) {
+		if clientSealed {
+			return data, utils.ValidateSealed(data)
+		}
+		return utils.SealToPublicKey(data, key)
+	})
+}
+
+// ListRequestFiles lists the files received by a file request. It needs
+// the owner token.
+func ListRequestFiles(w http.ResponseWriter, r *http.Request) {
+	requestID := chi.URLParam(r, "id")
+	token := r.URL.Query().Get("token")
+	req, err := storage.GetRequest(requestID)
+	if err != nil || subtle.ConstantTimeCompare([]byte(utils.HashToken(token)), []byte(req.OwnerToken)) != 1 {
+		http.Error(w, "File request not found or expired", http.StatusNotFound)
+		return
+	}
+
+	ids, err := storage.RequestFileIDs(requestID)
+	if err != nil {
+		log.Printf("Request error: failed to list files: id=%s, error=%v", requestID, err)
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+	left, err := storage.RequestUploadsLeft(requestID, req)
+	if err != nil {
+		log.Printf("Request error: failed to count uploads: id=%s, error=%v", requestID, err)
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+
+	files := make([]ReceivedFile, 0, len(ids))
+	for _, id := range ids {
+		storedData, err := storage.Get(id)
+		if err != nil {
+			continue
+		}
+		files = append(files, ReceivedFile{
+			ID:            id,
+			URL:           "/file/" + id + "?token=" + token,
+			FileName:      storedData.FileName,
+			FileSize:      storedData.Size(),
+			DownloadsLeft: storedData.DownloadsLeft,
+			Sealed:        storedData.Sealed,
+			CreatedAt:     formatTimestamp(storedData.CreatedAt),
+			ExpiresAt:     formatTimestamp(storedData.ExpiresAt),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":           requestID,
+		"label":        req.Label,
+		"uploads_left": left,
+		"expires_at":   formatTimestamp(req.ExpiresAt),
+		"files":        files,
+	})
+}
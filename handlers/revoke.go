@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/Morizz00/self-destruct-share-api/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// RevokeFile lets the uploader destroy a file before it runs out of
+// downloads or expires
+func RevokeFile(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	storedData, err := storage.Get(id)
+	if err != nil || !ownerTokenAllowed(r, storedData) {
+		http.Error(w, "File not found or expired", http.StatusNotFound)
+		return
+	}
+	if err := storage.Delete(id); err != nil {
+		log.Printf("Revoke error: failed to delete file: id=%s, error=%v", id, err)
+		http.Error(w, "Failed to revoke file", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("File revoked: id=%s", id)
+	notify(id, storedData, nil, storage.EventRevoked)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Morizz00/self-destruct-share-api/storage"
+	"github.com/Morizz00/self-destruct-share-api/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+var errWrongKind = errors.New("entry is not of the requested kind")
+
+// SecretRequest is the body of POST /secret, sent as JSON or form fields
+type SecretRequest struct {
+	Text      string `json:"text"`
+	Downloads int    `json:"downloads"`
+	Expiry    int    `json:"expiry"`
+	Password  string `json:"password"`
+}
+
+// CreateSecret stores a self-destructing text secret through the same
+// storage layer as files
+func CreateSecret(w http.ResponseWriter, r *http.Request) {
+	var req SecretRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		r.Body = http.MaxBytesReader(w, r.Body, utils.MaxSecretSize*2)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	} else {
+		req.Text = r.FormValue("text")
+		req.Password = r.FormValue("password")
+		req.Downloads, _ = strconv.Atoi(r.FormValue("downloads"))
+		req.Expiry, _ = strconv.Atoi(r.FormValue("expiry"))
+	}
+
+	if err := utils.ValidateSecret(req.Text); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Downloads <= 0 {
+		req.Downloads = 1
+	}
+	if err := utils.ValidateDownloads(req.Downloads); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Expiry <= 0 {
+		req.Expiry = 5
+	}
+	if err := utils.ValidateExpiry(req.Expiry); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	expiry := time.Duration(req.Expiry) * time.Minute
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		log.Printf("Secret error: failed to hash password: %v", err)
+		http.Error(w, "Failed to process password", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	secret := storage.StoredFile{
+		Kind:          storage.KindSecret,
+		FileName:      "secret.txt",
+		MIME:          "text/plain; charset=utf-8",
+		Data:          []byte(req.Text),
+		Password:      hashedPassword,
+		DownloadsLeft: req.Downloads,
+		Expiry:        expiry,
+		MaxExpiresAt:  now.Add(expiry),
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(expiry),
+	}
+	id, err := createWithID("", func(id string) (bool, error) {
+		return storage.CreateFile(id, secret, expiry)
+	})
+	if err != nil {
+		log.Printf("Secret error: storage failed: %v", err)
+		http.Error(w, "storage error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Secret stored: id=%s, downloads=%d, expiry=%v", id, req.Downloads, expiry)
+	notify(id, secret, nil, storage.EventUploaded)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(UploadResponse{
+		ID:            id,
+		URL:           "/secret/" + id,
+		DownloadsLeft: req.Downloads,
+		CreatedAt:     formatTimestamp(secret.CreatedAt),
+		ExpiresAt:     formatTimestamp(secret.ExpiresAt),
+	})
+}
+
+// RevealSecret returns a secret's text, charging one download. The last
+// read destroys it.
+func RevealSecret(w http.ResponseWriter, r *http.Request) {
+	id, secret, recipient, ok := authorizeDownload(w, r, chi.URLParam(r, "id"), storage.KindSecret)
+	if !ok {
+		return
+	}
+	if !consumeAndSave(w, r, id, &secret, recipient) {
+		return
+	}
+	w.Header().Set("Content-Type", secret.MIME)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(secret.Data)
+}
+
+// secretSizeHint describes a secret's length only as a coarse power-of-two
+// bucket so metadata can't be used to guess its contents
+func secretSizeHint(size int) string {
+	limit := 256
+	for limit < size {
+		limit *= 4
+	}
+	if limit < 1024 {
+		return fmt.Sprintf("under %d bytes", limit)
+	}
+	return fmt.Sprintf("under %d KB", limit/1024)
+}
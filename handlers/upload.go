@@ -1,31 +1,45 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Morizz00/self-destruct-share-api/geoip"
+	"github.com/Morizz00/self-destruct-share-api/mailer"
 	"github.com/Morizz00/self-destruct-share-api/storage"
 	"github.com/Morizz00/self-destruct-share-api/utils"
 )
 
+// age_passphrase uploads run scrypt; at most maxScryptUploads do so at
+// once and the rest wait up to scryptQueueWait for a slot
+const (
+	maxScryptUploads = 2
+	scryptQueueWait  = 10 * time.Second
+)
+
+var scryptSlots = make(chan struct{}, maxScryptUploads)
+
+// email_to makes the server mail strangers, so links emailed per address
+// and in total are capped per linkEmailWindow
+const (
+	maxLinkEmailsPerIP = 20
+	maxLinkEmails      = 500
+	linkEmailWindow    = time.Hour
+)
+
 func Upload(w http.ResponseWriter, r *http.Request) {
-	file, fileHeader, err := r.FormFile("file")
+	content, err := readUploadedContent(r)
 	if err != nil {
-		log.Printf("Upload error: failed to get file from form: %v", err)
-		http.Error(w, "Upload fail", http.StatusBadRequest)
-		return
-	}
-	defer file.Close()
-
-	// Validate file size
-	if err := utils.ValidateFileSize(fileHeader.Size); err != nil {
-		log.Printf("Upload error: %v (size: %d)", err, fileHeader.Size)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("Upload error: failed to read upload: %v", err)
+		http.Error(w, uploadErrorMessage(err), http.StatusBadRequest)
 		return
 	}
 
@@ -37,10 +51,8 @@ func Upload(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid slug format", http.StatusBadRequest)
 			return
 		}
-
-		_, err := storage.Get(slug)
-		if err == nil {
-			http.Error(w, "this custom link is already taken, try another one", http.StatusBadRequest)
+		if utils.ReservedSlug(slug) {
+			http.Error(w, "this custom link is reserved, try another one", http.StatusBadRequest)
 			return
 		}
 	}
@@ -55,6 +67,25 @@ func Upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Per-recipient links: each recipient gets its own budget and the
+	// file's budget becomes their total
+	var recipients map[string]*storage.Recipient
+	var recipientLinks []RecipientLink
+	if raw := r.FormValue("recipients"); raw != "" {
+		recipients, recipientLinks, err = parseRecipients(raw)
+		if err != nil {
+			log.Printf("Upload error: invalid recipients: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(recipientLinks) > 0 {
+			downloads = 0
+			for _, link := range recipientLinks {
+				downloads += link.Downloads
+			}
+		}
+	}
+
 	expiryMinutes := 5
 	if parsed, err := strconv.Atoi(r.FormValue("expiry")); err == nil && parsed > 0 {
 		expiryMinutes = parsed
@@ -66,20 +97,268 @@ func Upload(w http.ResponseWriter, r *http.Request) {
 	}
 	expiry := time.Duration(expiryMinutes) * time.Minute
 
-	fileData, err := io.ReadAll(file)
-	if err != nil {
-		log.Printf("Upload error: failed to read file: %v", err)
-		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+	// Fuse mode: expiry is the maximum lifetime and the first download or
+	// preview shrinks the remaining time to the fuse length
+	var fuse time.Duration
+	if raw := r.FormValue("fuse"); raw != "" {
+		fuseMinutes, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "fuse must be a number of minutes", http.StatusBadRequest)
+			return
+		}
+		if err := utils.ValidateFuse(fuseMinutes, expiryMinutes); err != nil {
+			log.Printf("Upload error: invalid fuse: %d minutes", fuseMinutes)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fuse = time.Duration(fuseMinutes) * time.Minute
+	}
+
+	// Sliding mode: every download or preview extends the lifetime by the
+	// idle window, never past expiry
+	var idleTimeout time.Duration
+	if raw := r.FormValue("idle"); raw != "" {
+		idleMinutes, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "idle must be a number of minutes", http.StatusBadRequest)
+			return
+		}
+		if fuse > 0 {
+			http.Error(w, "fuse and idle cannot be combined", http.StatusBadRequest)
+			return
+		}
+		if err := utils.ValidateIdle(idleMinutes, expiryMinutes); err != nil {
+			log.Printf("Upload error: invalid idle: %d minutes", idleMinutes)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		idleTimeout = time.Duration(idleMinutes) * time.Minute
+	}
+
+	// Embargo: the file is stored now but only released later, so the
+	// storage TTL covers the wait plus the normal expiry
+	now := time.Now()
+	var availableFrom time.Time
+	ttl := expiry
+	if raw := r.FormValue("available_from"); raw != "" {
+		availableFrom, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			http.Error(w, "available_from must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		if err := utils.ValidateAvailableFrom(availableFrom, now); err != nil {
+			log.Printf("Upload error: invalid available_from: %s", raw)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ttl += availableFrom.Sub(now)
+	}
+	maxExpiresAt := now.Add(ttl)
+	if idleTimeout > 0 {
+		ttl -= expiry - idleTimeout
+	}
+
+	accessWindow := r.FormValue("access_window")
+	accessTimezone := r.FormValue("access_timezone")
+	if accessWindow != "" {
+		if _, err := utils.ParseAccessWindow(accessWindow, accessTimezone); err != nil {
+			log.Printf("Upload error: invalid access window: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var allowCIDRs []string
+	if raw := r.FormValue("allow_cidrs"); raw != "" {
+		nets, err := utils.ParseCIDRs(raw)
+		if err != nil {
+			log.Printf("Upload error: invalid allow_cidrs: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, n := range nets {
+			allowCIDRs = append(allowCIDRs, n.String())
+		}
+	}
+
+	var allowCountries []string
+	if raw := r.FormValue("allow_countries"); raw != "" {
+		if !geoip.Enabled() {
+			http.Error(w, "Country restrictions are not available on this server", http.StatusBadRequest)
+			return
+		}
+		allowCountries, err = utils.ParseCountryCodes(raw)
+		if err != nil {
+			log.Printf("Upload error: invalid allow_countries: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var pgpFingerprints []string
+	if armored := r.Form["pgp_key"]; len(armored) > 0 {
+		keys, err := utils.ParsePGPKeys(armored)
+		if err != nil {
+			log.Printf("Upload error: invalid pgp_key: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = content.encrypt(".gpg", "application/pgp-encrypted", func(name string, data []byte) ([]byte, error) {
+			return utils.EncryptToPGPKeys(data, keys, name)
+		})
+		if err != nil {
+			log.Printf("Upload error: failed to encrypt to pgp_key: %v", err)
+			http.Error(w, "Failed to encrypt file: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, key := range keys {
+			pgpFingerprints = append(pgpFingerprints, utils.PGPFingerprint(key))
+		}
+	}
+
+	// age envelope: either check an upload the client already encrypted or
+	// encrypt to the given recipients. age has no registered media type.
+	ageKeys, agePassphrase := r.Form["age_recipient"], r.FormValue("age_passphrase")
+	ageEncrypted := r.FormValue("age_encrypted") == "true"
+	wantsAge := len(ageKeys) > 0 || agePassphrase != ""
+	if (ageEncrypted || wantsAge) && len(pgpFingerprints) > 0 {
+		http.Error(w, "age and pgp_key can't be combined", http.StatusBadRequest)
 		return
 	}
+	switch {
+	case ageEncrypted && wantsAge:
+		http.Error(w, "age_encrypted uploads can't be encrypted again", http.StatusBadRequest)
+		return
+	case ageEncrypted:
+		err = content.encrypt(".age", "application/octet-stream", func(_ string, data []byte) ([]byte, error) {
+			return data, utils.ValidateAgeHeader(data)
+		})
+		if err != nil {
+			log.Printf("Upload error: invalid age file: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case wantsAge:
+		ageRecipients, err := utils.ParseAgeRecipients(ageKeys, agePassphrase)
+		if err != nil {
+			log.Printf("Upload error: invalid age recipients: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if agePassphrase != "" {
+			// scrypt is costly on purpose, so only a few uploads run it at once
+			select {
+			case scryptSlots <- struct{}{}:
+				defer func() { <-scryptSlots }()
+			case <-time.After(scryptQueueWait):
+				http.Error(w, "Server busy, try again later", http.StatusServiceUnavailable)
+				return
+			case <-r.Context().Done():
+				return
+			}
+		}
+		err = content.encrypt(".age", "application/octet-stream", func(_ string, data []byte) ([]byte, error) {
+			return utils.EncryptToAge(data, ageRecipients)
+		})
+		if err != nil {
+			log.Printf("Upload error: failed to age-encrypt: %v", err)
+			http.Error(w, "Failed to encrypt file", http.StatusInternalServerError)
+			return
+		}
+	}
 
-	// Double-check size after reading (in case Content-Length was wrong)
-	if err := utils.ValidateFileSize(int64(len(fileData))); err != nil {
-		log.Printf("Upload error: file size validation failed after read: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	// Download and destruction events are signed with a per-file secret
+	var webhook storage.Webhook
+	if webhookURL := r.FormValue("webhook_url"); webhookURL != "" {
+		if err := utils.ValidateWebhookURL(webhookURL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		secret, err := utils.GenerateToken(32)
+		if err != nil {
+			log.Printf("Upload error: failed to generate webhook secret: %v", err)
+			http.Error(w, "Failed to process upload", http.StatusInternalServerError)
+			return
+		}
+		webhook = storage.Webhook{URL: webhookURL, Secret: secret}
+	}
+
+	// Files shared with named recipients seal the note under the id, since
+	// recipients may each have their own password
+	messagePassword := password
+	if len(recipients) > 0 {
+		messagePassword = ""
+	}
+	if r.FormValue("message") != "" && !messagesEnabled(messagePassword) {
+		http.Error(w, "Messages are not available on this server", http.StatusBadRequest)
 		return
 	}
 
+	// Email notifications for the uploader, and the link for recipients
+	notifyEmail := r.FormValue("notify_email")
+	var emailTo, verifyEmails []string
+	if notifyEmail != "" || r.FormValue("email_to") != "" || r.FormValue("verify_emails") != "" {
+		if !mailer.Enabled() {
+			http.Error(w, "Email is not available on this server", http.StatusBadRequest)
+			return
+		}
+		if (notifyEmail != "" || r.FormValue("email_to") != "") && mailer.PublicURL() == "" {
+			http.Error(w, "Emailing links is not available on this server", http.StatusBadRequest)
+			return
+		}
+		if r.FormValue("email_to") != "" && len(recipients) > 0 {
+			http.Error(w, "email_to can't be combined with recipients", http.StatusBadRequest)
+			return
+		}
+		emails, err := utils.ParseEmails(notifyEmail)
+		if err != nil || len(emails) > 1 {
+			http.Error(w, "notify_email must be a single email address", http.StatusBadRequest)
+			return
+		}
+		if len(emails) == 1 {
+			notifyEmail = emails[0]
+		}
+		emailTo, err = utils.ParseEmails(r.FormValue("email_to"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(emailTo) > 0 {
+			ok, err := storage.ReserveLinkEmails(r.RemoteAddr, int64(len(emailTo)), maxLinkEmailsPerIP, maxLinkEmails, linkEmailWindow)
+			if err != nil {
+				log.Printf("Upload error: failed to count emails: %v", err)
+				http.Error(w, "Failed to process upload", http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				http.Error(w, "Too many emails sent, try again later", http.StatusTooManyRequests)
+				return
+			}
+		}
+		// Only downloaders who confirm a code sent to one of these may
+		// download
+		allowed, err := utils.ParseEmails(r.FormValue("verify_emails"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, email := range allowed {
+			verifyEmails = append(verifyEmails, emailHash(email))
+		}
+	}
+
+	// Authenticator second factor: every download needs a current code
+	// from the secret handed to the uploader
+	var totpSecret string
+	if r.FormValue("totp") == "true" {
+		totpSecret, err = utils.GenerateTOTPSecret()
+		if err != nil {
+			log.Printf("Upload error: failed to generate TOTP secret: %v", err)
+			http.Error(w, "Failed to process upload", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Hash password if provided
 	hashedPassword := ""
 	if password != "" {
@@ -91,31 +370,255 @@ func Upload(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Sanitize filename
-	sanitizedFilename := utils.SanitizeFilename(fileHeader.Filename)
+	// The owner token lets the uploader follow the file's events
+	ownerToken, err := utils.GenerateToken(16)
+	if err != nil {
+		log.Printf("Upload error: failed to generate owner token: %v", err)
+		http.Error(w, "Failed to process upload", http.StatusInternalServerError)
+		return
+	}
 
 	storeIt := storage.StoredFile{
-		FileName:      sanitizedFilename,
-		MIME:          fileHeader.Header.Get("Content-Type"),
-		Data:          fileData,
-		Password:      hashedPassword,
-		DownloadsLeft: downloads,
-		Expiry:        expiry,
+		FileName:       content.FileName,
+		MIME:           content.MIME,
+		Data:           content.Data,
+		Password:       hashedPassword,
+		DownloadsLeft:  downloads,
+		Expiry:         expiry,
+		AllowCIDRs:     allowCIDRs,
+		AllowCountries: allowCountries,
+		AvailableFrom:  availableFrom,
+		AccessWindow:   accessWindow,
+		AccessTimezone: accessTimezone,
+		Fuse:           fuse,
+		IdleTimeout:    idleTimeout,
+		MaxExpiresAt:   maxExpiresAt,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(ttl),
+		Recipients:     recipients,
+		Members:        content.Members,
+		PGPKeys:        pgpFingerprints,
+		OwnerToken:     utils.HashToken(ownerToken),
+		VerifyEmails:   verifyEmails,
+		TOTPSecret:     totpSecret,
 	}
-	var id string
-	if slug != "" {
-		id = slug
-	} else {
-		id = utils.GenerateID()
+	// The sender note is sealed under the id, so it is added as each id
+	// is tried
+	id, err := createWithID(slug, func(id string) (bool, error) {
+		sealed, err := sealMessage(id, messagePassword, r.FormValue("message"))
+		if err != nil {
+			return false, err
+		}
+		storeIt.Message = sealed
+		return storage.CreateFile(id, storeIt, ttl)
+	})
+	if errors.Is(err, errIDTaken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	err = storage.StoreFile(id, storeIt, expiry)
-
 	if err != nil {
 		log.Printf("Upload error: storage failed: %v", err)
 		http.Error(w, "storage error", http.StatusInternalServerError)
 		return
 	}
-	log.Printf("File uploaded successfully: id=%s, filename=%s, size=%d, downloads=%d, expiry=%v", 
-		id, sanitizedFilename, len(fileData), downloads, expiry)
-	fmt.Fprintf(w, "File uploaded--Download:/file/%s\n", id)
+
+	if webhook.URL != "" {
+		// Kept past the file's lifetime so its expiry is still delivered
+		if err := storage.StoreWebhook(id, webhook, maxExpiresAt.Sub(now)+time.Hour); err != nil {
+			log.Printf("Upload error: failed to store webhook: %v", err)
+			storage.Delete(id)
+			http.Error(w, "storage error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	downloadURL := mailer.PublicURL() + "/download.html?id=" + id
+	if notifyEmail != "" {
+		notification := storage.Notification{Email: notifyEmail, FileName: content.FileName, URL: downloadURL}
+		if err := storage.StoreNotification(id, notification, maxExpiresAt.Sub(now)+time.Hour); err != nil {
+			log.Printf("Upload error: failed to store notification: %v", err)
+			storage.Delete(id)
+			http.Error(w, "storage error", http.StatusInternalServerError)
+			return
+		}
+		if storeIt.ExpiresAt.Sub(now) >= 2*mailer.ReminderLead {
+			storage.ScheduleReminder(id, storeIt.ExpiresAt.Add(-mailer.ReminderLead))
+		}
+	}
+	log.Printf("File uploaded successfully: id=%s, filename=%s, size=%d, downloads=%d, expiry=%v",
+		id, content.FileName, storeIt.Size(), downloads, expiry)
+	notify(id, storeIt, nil, storage.EventUploaded)
+
+	for i := range recipientLinks {
+		recipientLinks[i].URL = "/file/" + recipientRef(id, recipientLinks[i].token)
+	}
+
+	if len(emailTo) > 0 {
+		data := mailer.Data{
+			FileID:        id,
+			FileName:      content.FileName,
+			URL:           downloadURL,
+			DownloadsLeft: downloads,
+			ExpiresAt:     storeIt.ExpiresAt.UTC().Format(time.RFC1123),
+			HasPassword:   hashedPassword != "",
+		}
+		// One message per address so recipients don't see each other
+		go func() {
+			for _, to := range emailTo {
+				if err := mailer.Send([]string{to}, mailer.TemplateLink, data); err != nil {
+					log.Printf("Upload error: failed to email link: id=%s, error=%v", id, err)
+				}
+			}
+		}()
+	}
+
+	resp := UploadResponse{
+		ID:            id,
+		URL:           "/file/" + id,
+		DownloadsLeft: downloads,
+		CreatedAt:     formatTimestamp(storeIt.CreatedAt),
+		ExpiresAt:     formatTimestamp(storeIt.ExpiresAt),
+		AvailableFrom: formatTimestamp(availableFrom),
+		Recipients:    recipientLinks,
+		OwnerToken:    ownerToken,
+		EventsURL:     "/file/" + id + "/events?token=" + ownerToken,
+		WebhookSecret: webhook.Secret,
+	}
+	if totpSecret != "" {
+		resp.TOTPSecret = totpSecret
+		resp.TOTPURI = utils.TOTPURI(totpSecret, "FileOrcha", id)
+	}
+	writeUploadResponse(w, r, resp)
+}
+
+// UploadResponse describes a stored upload. It is returned as JSON to
+// clients that ask for it and summarised in headers otherwise.
+type UploadResponse struct {
+	ID            string          `json:"id"`
+	URL           string          `json:"url"`
+	DownloadsLeft int             `json:"downloads_left"`
+	CreatedAt     string          `json:"created_at"`
+	ExpiresAt     string          `json:"expires_at"`
+	AvailableFrom string          `json:"available_from,omitempty"`
+	Recipients    []RecipientLink `json:"recipients,omitempty"`
+	OwnerToken    string          `json:"owner_token,omitempty"`
+	EventsURL     string          `json:"events_url,omitempty"`
+	WebhookSecret string          `json:"webhook_secret,omitempty"`
+	TOTPSecret    string          `json:"totp_secret,omitempty"`
+	TOTPURI       string          `json:"totp_uri,omitempty"`
+}
+
+// writeUploadResponse keeps the original plain text body for existing
+// clients and switches to JSON when the request accepts it
+func writeUploadResponse(w http.ResponseWriter, r *http.Request, resp UploadResponse) {
+	w.Header().Set("X-File-Id", resp.ID)
+	w.Header().Set("X-Created-At", resp.CreatedAt)
+	w.Header().Set("X-Expires-At", resp.ExpiresAt)
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	fmt.Fprintf(w, "File uploaded--Download:%s\n", resp.URL)
+	for _, link := range resp.Recipients {
+		fmt.Fprintf(w, "Recipient %s (%d downloads):%s\n", link.Label, link.Downloads, link.URL)
+	}
+	if resp.EventsURL != "" {
+		fmt.Fprintf(w, "Events:%s\n", resp.EventsURL)
+	}
+	if resp.WebhookSecret != "" {
+		fmt.Fprintf(w, "Webhook secret:%s\n", resp.WebhookSecret)
+	}
+	if resp.TOTPURI != "" {
+		fmt.Fprintf(w, "Authenticator:%s\n", resp.TOTPURI)
+	}
+}
+
+// uploadedContent is the payload of a multipart upload: a single file, or
+// a bundle when several "file" fields were sent
+type uploadedContent struct {
+	FileName string
+	MIME     string
+	Data     []byte
+	Members  []storage.BundleMember
+}
+
+// size returns the payload size, summed over members for bundles
+func (c uploadedContent) size() int {
+	return storage.StoredFile{Data: c.Data, Members: c.Members}.Size()
+}
+
+// encrypt replaces every payload with fn(payload), marking the result with
+// the given file name suffix and MIME type. Bundle members are encrypted
+// one by one so they can still be downloaded individually.
+func (c *uploadedContent) encrypt(suffix, mime string, fn func(name string, data []byte) ([]byte, error)) error {
+	var err error
+	if len(c.Members) == 0 {
+		if c.Data, err = fn(c.FileName, c.Data); err != nil {
+			return err
+		}
+		c.FileName = strings.TrimSuffix(c.FileName, suffix) + suffix
+		c.MIME = mime
+		return nil
+	}
+	for i := range c.Members {
+		member := &c.Members[i]
+		if member.Data, err = fn(member.Name, member.Data); err != nil {
+			return err
+		}
+		member.Name = strings.TrimSuffix(member.Name, suffix) + suffix
+		member.MIME = mime
+	}
+	return nil
+}
+
+// readUploadedContent reads and size-checks the "file" field(s) of a
+// multipart upload, sanitizing the file name
+func readUploadedContent(r *http.Request) (uploadedContent, error) {
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		return uploadedContent{}, err
+	}
+	defer file.Close()
+
+	// Several "file" fields make a bundle; sizes are checked per member
+	if files := r.MultipartForm.File["file"]; len(files) > 1 {
+		members, err := readBundle(files, r.MultipartForm.Value["paths"])
+		if err != nil {
+			return uploadedContent{}, err
+		}
+		return uploadedContent{
+			FileName: bundleFileName(r.FormValue("bundle_name")),
+			MIME:     "application/zip",
+			Members:  members,
+		}, nil
+	}
+
+	// Validate file size
+	if err := utils.ValidateFileSize(fileHeader.Size); err != nil {
+		return uploadedContent{}, err
+	}
+	fileData, err := io.ReadAll(file)
+	if err != nil {
+		return uploadedContent{}, err
+	}
+	// Double-check size after reading (in case Content-Length was wrong)
+	if err := utils.ValidateFileSize(int64(len(fileData))); err != nil {
+		return uploadedContent{}, err
+	}
+
+	return uploadedContent{
+		FileName: utils.SanitizeFilename(fileHeader.Filename),
+		MIME:     fileHeader.Header.Get("Content-Type"),
+		Data:     fileData,
+	}, nil
+}
+
+// uploadErrorMessage turns a readUploadedContent error into a client
+// message, keeping the generic text for malformed requests
+func uploadErrorMessage(err error) string {
+	if errors.Is(err, http.ErrMissingFile) || errors.Is(err, http.ErrNotMultipart) {
+		return "Upload fail"
+	}
+	return err.Error()
 }
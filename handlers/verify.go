@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Morizz00/self-destruct-share-api/mailer"
+	"github.com/Morizz00/self-destruct-share-api/storage"
+	"github.com/Morizz00/self-destruct-share-api/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// Files limited to verified email addresses are only served with an
+// access token, which downloaders get by confirming a code sent to one of
+// those addresses
+const (
+	verifyCodeDigits  = 6
+	verifyCodeExpiry  = 10 * time.Minute
+	verifyCodeResend  = time.Minute
+	maxVerifyAttempts = 5
+	accessTokenExpiry = 15 * time.Minute
+)
+
+type VerifyRequest struct {
+	Email string `json:"email"`
+	Code  string `json:"code,omitempty"`
+}
+
+type AccessTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+// emailHash normalizes an address before hashing it
+func emailHash(email string) string {
+	return utils.HashToken(strings.ToLower(strings.TrimSpace(email)))
+}
+
+// loadVerification resolves the file and request body shared by both
+// verification steps
+func loadVerification(w http.ResponseWriter, r *http.Request) (string, storage.StoredFile, VerifyRequest, bool) {
+	var req VerifyRequest
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return "", storage.StoredFile{}, req, false
+	}
+	id, storedData, _, err := loadFile(chi.URLParam(r, "id"))
+	if err != nil || len(storedData.VerifyEmails) == 0 {
+		http.Error(w, "File not found or expired", http.StatusNotFound)
+		return "", storage.StoredFile{}, req, false
+	}
+	return id, storedData, req, true
+}
+
+// RequestVerificationCode emails a one-time code to an allowed address.
+// The response is the same whether or not the address is allowed.
+func RequestVerificationCode(w http.ResponseWriter, r *http.Request) {
+	id, storedData, req, ok := loadVerification(w, r)
+	if !ok {
+		return
+	}
+
+	hash := emailHash(req.Email)
+	if slices.Contains(storedData.VerifyEmails, hash) {
+		code, err := utils.GenerateCode(verifyCodeDigits)
+		if err != nil {
+			log.Printf("Verify error: failed to generate code: %v", err)
+			http.Error(w, "Failed to send code", http.StatusInternalServerError)
+			return
+		}
+		sent, err := storage.StoreVerificationCode(id, hash, utils.HashToken(code), verifyCodeExpiry, verifyCodeResend)
+		if err != nil {
+			log.Printf("Verify error: failed to store code: id=%s, error=%v", id, err)
+			http.Error(w, "Failed to send code", http.StatusInternalServerError)
+			return
+		}
+		if sent {
+			data := mailer.Data{
+				FileID:    id,
+				FileName:  storedData.FileName,
+				Code:      code,
+				ExpiresAt: time.Now().Add(verifyCodeExpiry).UTC().Format(time.RFC1123),
+			}
+			if err := mailer.Send([]string{req.Email}, mailer.TemplateCode, data); err != nil {
+				log.Printf("Verify error: failed to email code: id=%s, error=%v", id, err)
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("If this address may download the file, a code has been sent to it\n"))
+}
+
+// ConfirmVerificationCode exchanges a valid code for a short-lived access
+// token that downloads and previews accept as access_token
+func ConfirmVerificationCode(w http.ResponseWriter, r *http.Request) {
+	id, _, req, ok := loadVerification(w, r)
+	if !ok {
+		return
+	}
+
+	valid, err := storage.CheckVerificationCode(id, emailHash(req.Email), utils.HashToken(strings.TrimSpace(req.Code)),
+		maxVerifyAttempts, verifyCodeExpiry)
+	if err == storage.ErrTooManyAttempts {
+		http.Error(w, "Too many attempts, request a new code", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		log.Printf("Verify error: failed to check code: id=%s, error=%v", id, err)
+		http.Error(w, "Failed to check code", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		log.Printf("Verify error: wrong code: id=%s", id)
+		http.Error(w, "Wrong or expired code", http.StatusForbidden)
+		return
+	}
+
+	token, err := utils.GenerateToken(16)
+	if err != nil {
+		log.Printf("Verify error: failed to generate access token: %v", err)
+		http.Error(w, "Failed to issue access token", http.StatusInternalServerError)
+		return
+	}
+	if err := storage.StoreAccessToken(utils.HashToken(token), id, accessTokenExpiry); err != nil {
+		log.Printf("Verify error: failed to store access token: id=%s, error=%v", id, err)
+		http.Error(w, "Failed to issue access token", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Email verified: id=%s", id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(AccessTokenResponse{
+		AccessToken: token,
+		ExpiresAt:   formatTimestamp(time.Now().Add(accessTokenExpiry)),
+	})
+}
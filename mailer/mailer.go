@@ -0,0 +1,319 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/smtp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/Morizz00/self-destruct-share-api/storage"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	eventGroup = "notifications"
+	// ReminderLead is how long before expiry the uploader is reminded.
+	// Files that live less than twice as long get no reminder.
+	ReminderLead = 10 * time.Minute
+	// maxFileName keeps uploader-chosen names from filling subjects
+	maxFileName = 80
+)
+
+// Template names; each can be replaced by a <name>.txt file in
+// MAIL_TEMPLATE_DIR
+const (
+	TemplateDownloaded = "downloaded"
+	TemplateExhausted  = "exhausted"
+	TemplateExpiring   = "expiring"
+	TemplateLink       = "link"
+	TemplateCode       = "code"
+)
+
+// Templates start with a "Subject:" line, then a blank line and the body
+var defaultTemplates = map[string]string{
+	TemplateDownloaded: `Subject: {{.FileName}} was downloaded
+
+Your file {{.FileName}} was just downloaded{{if .Recipient}} by {{.Recipient}}{{end}}.
+Downloads left: {{.DownloadsLeft}}
+
+{{.URL}}
+`,
+	TemplateExhausted: `Subject: {{.FileName}} has self-destructed
+
+Your file {{.FileName}} was downloaded for the last time and has been deleted.
+`,
+	TemplateExpiring: `Subject: {{.FileName}} expires soon
+
+Your file {{.FileName}} will self-destruct at {{.ExpiresAt}}.
+
+{{.URL}}
+`,
+	TemplateCode: `Subject: Your download code for {{.FileName}}
+
+Your code is {{.Code}}
+
+Enter it on the download page to get {{.FileName}}. It expires at {{.ExpiresAt}}.
+If you didn't ask for it, you can ignore this email.
+`,
+	TemplateLink: `Subject: A file was shared with you: {{.FileName}}
+
+Someone shared {{.FileName}} with you on FileOrcha:
+
+{{.URL}}
+
+The file self-destructs after {{.DownloadsLeft}} download(s) or at {{.ExpiresAt}}, whichever comes first.{{if .HasPassword}}
+You will need the password from the sender to open it.{{end}}
+`,
+}
+
+// Data is what templates are rendered with
+type Data struct {
+	FileID        string
+	FileName      string
+	URL           string
+	DownloadsLeft int
+	Recipient     string
+	ExpiresAt     string
+	HasPassword   bool
+	Code          string
+}
+
+type config struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+	// publicURL is the base of links in emails. It comes from the
+	// configuration, never from requests, so clients can't make the
+	// server mail links to other sites.
+	publicURL string
+}
+
+var (
+	cfg       config
+	templates = map[string]*template.Template{}
+
+	// sendMail is swapped for an in-process stand-in when testing
+	sendMail = smtp.SendMail
+)
+
+// Load reads the SMTP settings and templates. Email stays disabled when
+// SMTP_HOST is not set.
+func Load() error {
+	cfg = config{
+		host:      os.Getenv("SMTP_HOST"),
+		port:      os.Getenv("SMTP_PORT"),
+		username:  os.Getenv("SMTP_USERNAME"),
+		password:  os.Getenv("SMTP_PASSWORD"),
+		from:      os.Getenv("SMTP_FROM"),
+		publicURL: strings.TrimRight(os.Getenv("PUBLIC_URL"), "/"),
+	}
+	if cfg.port == "" {
+		cfg.port = "587"
+	}
+	if cfg.host != "" && cfg.from == "" {
+		return errors.New("SMTP_FROM is required when SMTP_HOST is set")
+	}
+	if cfg.publicURL != "" {
+		u, err := url.Parse(cfg.publicURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("PUBLIC_URL must be an absolute http or https URL")
+		}
+	}
+
+	dir := os.Getenv("MAIL_TEMPLATE_DIR")
+	for name, text := range defaultTemplates {
+		if dir != "" {
+			custom, err := os.ReadFile(filepath.Join(dir, name+".txt"))
+			if err == nil {
+				text = string(custom)
+			} else if !os.IsNotExist(err) {
+				return err
+			}
+		}
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return fmt.Errorf("mail template %s: %v", name, err)
+		}
+		templates[name] = tmpl
+	}
+	return nil
+}
+
+// Enabled reports whether an SMTP server is configured
+func Enabled() bool {
+	return cfg.host != ""
+}
+
+// PublicURL returns the configured base URL for links in emails, or ""
+// when emails can't contain links
+func PublicURL() string {
+	return cfg.publicURL
+}
+
+// Send renders a template and mails it to every address
+func Send(to []string, name string, data Data) error {
+	data.FileName = mailFileName(data.FileName)
+	var rendered bytes.Buffer
+	if err := templates[name].Execute(&rendered, data); err != nil {
+		return err
+	}
+	subject, body, _ := strings.Cut(rendered.String(), "\n\n")
+	subject = strings.TrimSpace(strings.TrimPrefix(subject, "Subject:"))
+	// File names end up in the subject; keep them from adding headers
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", cfg.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if cfg.username != "" {
+		auth = smtp.PlainAuth("", cfg.username, cfg.password, cfg.host)
+	}
+	return sendMail(cfg.host+":"+cfg.port, auth, cfg.from, to, msg.Bytes())
+}
+
+// mailFileName turns control characters, line breaks included, into spaces
+// and shortens names longer than maxFileName
+func mailFileName(name string) string {
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, name))
+	if runes := []rune(name); len(runes) > maxFileName {
+		name = string(runes[:maxFileName-3]) + "..."
+	}
+	return name
+}
+
+// Run sends uploader notifications for file events and pre-expiry
+// reminders until the process exits
+func Run() {
+	go remindLoop()
+
+	hostname, _ := os.Hostname()
+	consumer := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	for {
+		if err := storage.EnsureEventGroup(eventGroup); err != nil {
+			log.Printf("Mail error: failed to create consumer group: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		break
+	}
+	for {
+		events, err := storage.ReadEventGroup(eventGroup, consumer, 50, 5*time.Second)
+		if err != nil {
+			log.Printf("Mail error: failed to read events: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		for _, event := range events {
+			handleEvent(event.Event)
+			storage.AckEvent(eventGroup, event.StreamID)
+		}
+	}
+}
+
+func handleEvent(event storage.Event) {
+	switch event.Type {
+	case storage.EventDownloaded, storage.EventDestroyed, storage.EventRevoked, storage.EventExpired:
+	default:
+		return
+	}
+
+	n, err := storage.GetNotification(event.FileID)
+	if errors.Is(err, redis.Nil) {
+		return
+	}
+	if err != nil {
+		log.Printf("Mail error: failed to load notification: id=%s, error=%v", event.FileID, err)
+		return
+	}
+	if event.Type != storage.EventDownloaded {
+		storage.DeleteNotification(event.FileID)
+	}
+	if err := notifyUploader(n, event); err != nil {
+		log.Printf("Mail error: failed to send %s notification: id=%s, error=%v", event.Type, event.FileID, err)
+	}
+}
+
+// notifyUploader mails the uploader about a file event. Expiry is only
+// announced ahead of time, by remind, so expired events send nothing, and
+// the uploader revoked the file themselves.
+func notifyUploader(n storage.Notification, event storage.Event) error {
+	var name string
+	switch event.Type {
+	case storage.EventDownloaded:
+		name = TemplateDownloaded
+	case storage.EventDestroyed:
+		name = TemplateExhausted
+	default:
+		return nil
+	}
+	return Send([]string{n.Email}, name, Data{
+		FileID:        event.FileID,
+		FileName:      n.FileName,
+		URL:           n.URL,
+		DownloadsLeft: event.DownloadsLeft,
+		Recipient:     event.Recipient,
+	})
+}
+
+// remindLoop mails uploaders whose files are about to expire. Sliding
+// expiry can push a file's end back, so reminders are checked against the
+// file's current TTL and rescheduled when it moved.
+func remindLoop() {
+	for range time.Tick(30 * time.Second) {
+		now := time.Now()
+		ids, err := storage.ClaimDueReminders(now, 50)
+		if err != nil {
+			log.Printf("Mail error: failed to claim reminders: %v", err)
+			continue
+		}
+		for _, id := range ids {
+			ttl, err := storage.TTL(id)
+			if err != nil || ttl <= 0 {
+				continue
+			}
+			if ttl > ReminderLead+time.Minute {
+				storage.ScheduleReminder(id, now.Add(ttl-ReminderLead))
+				continue
+			}
+			n, err := storage.GetNotification(id)
+			if err != nil {
+				continue
+			}
+			if err := remind(id, n, now.Add(ttl)); err != nil {
+				log.Printf("Mail error: failed to send reminder: id=%s, error=%v", id, err)
+			}
+		}
+	}
+}
+
+// remind mails the uploader that a file expires at expiresAt
+func remind(id string, n storage.Notification, expiresAt time.Time) error {
+	return Send([]string{n.Email}, TemplateExpiring, Data{
+		FileID:    id,
+		FileName:  n.FileName,
+		URL:       n.URL,
+		ExpiresAt: expiresAt.UTC().Format(time.RFC1123),
+	})
+}
@@ -0,0 +1,196 @@
+package mailer
+
+import (
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Morizz00/self-destruct-share-api/storage"
+)
+
+// sentMail is one message handed to the SMTP stand-in
+type sentMail struct {
+	addr string
+	from string
+	to   []string
+	msg  *mail.Message
+	body string
+}
+
+// stubSMTP configures the mailer and replaces sendMail with a stand-in
+// that records every message instead of sending it
+func stubSMTP(t *testing.T) *[]sentMail {
+	t.Helper()
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_PORT", "2525")
+	t.Setenv("SMTP_FROM", "files@example.com")
+	t.Setenv("PUBLIC_URL", "https://files.example.com")
+	if err := Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	var sent []sentMail
+	original := sendMail
+	sendMail = func(addr string, _ smtp.Auth, from string, to []string, msg []byte) error {
+		parsed, err := mail.ReadMessage(strings.NewReader(string(msg)))
+		if err != nil {
+			t.Fatalf("unparseable message: %v\n%s", err, msg)
+		}
+		_, body, _ := strings.Cut(string(msg), "\r\n\r\n")
+		sent = append(sent, sentMail{addr: addr, from: from, to: to, msg: parsed, body: body})
+		return nil
+	}
+	t.Cleanup(func() { sendMail = original })
+	return &sent
+}
+
+var notification = storage.Notification{
+	Email:    "owner@example.com",
+	FileName: "report.pdf",
+	URL:      "https://files.example.com/download.html?id=abc123",
+}
+
+// only returns the single message sent, failing otherwise
+func only(t *testing.T, sent []sentMail) sentMail {
+	t.Helper()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(sent))
+	}
+	m := sent[0]
+	if m.addr != "smtp.example.com:2525" {
+		t.Errorf("addr = %q", m.addr)
+	}
+	if m.from != "files@example.com" || m.msg.Header.Get("From") != "files@example.com" {
+		t.Errorf("from = %q, From header = %q", m.from, m.msg.Header.Get("From"))
+	}
+	if len(m.to) != 1 || m.to[0] != notification.Email || m.msg.Header.Get("To") != notification.Email {
+		t.Errorf("to = %v, To header = %q", m.to, m.msg.Header.Get("To"))
+	}
+	if ct := m.msg.Header.Get("Content-Type"); ct != "text/plain; charset=UTF-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if _, err := m.msg.Header.Date(); err != nil {
+		t.Errorf("Date header: %v", err)
+	}
+	if strings.Contains(strings.ReplaceAll(m.body, "\r\n", ""), "\n") {
+		t.Errorf("body has bare line feeds: %q", m.body)
+	}
+	return m
+}
+
+func assertBody(t *testing.T, body string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(body, w) {
+			t.Errorf("body missing %q:\n%s", w, body)
+		}
+	}
+}
+
+func TestDownloadedNotification(t *testing.T) {
+	sent := stubSMTP(t)
+	event := storage.Event{Type: storage.EventDownloaded, FileID: "abc123", DownloadsLeft: 2, Recipient: "Alice"}
+	if err := notifyUploader(notification, event); err != nil {
+		t.Fatal(err)
+	}
+
+	m := only(t, *sent)
+	if got := m.msg.Header.Get("Subject"); got != "report.pdf was downloaded" {
+		t.Errorf("Subject = %q", got)
+	}
+	assertBody(t, m.body, "report.pdf was just downloaded by Alice.", "Downloads left: 2", notification.URL)
+}
+
+func TestExhaustedNotification(t *testing.T) {
+	sent := stubSMTP(t)
+	event := storage.Event{Type: storage.EventDestroyed, FileID: "abc123"}
+	if err := notifyUploader(notification, event); err != nil {
+		t.Fatal(err)
+	}
+
+	m := only(t, *sent)
+	if got := m.msg.Header.Get("Subject"); got != "report.pdf has self-destructed" {
+		t.Errorf("Subject = %q", got)
+	}
+	assertBody(t, m.body, "downloaded for the last time and has been deleted")
+}
+
+func TestExpiredEventSendsNothing(t *testing.T) {
+	sent := stubSMTP(t)
+	event := storage.Event{Type: storage.EventExpired, FileID: "abc123"}
+	if err := notifyUploader(notification, event); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 0 {
+		t.Fatalf("sent %d messages for an expired file, want 0", len(*sent))
+	}
+}
+
+func TestReminder(t *testing.T) {
+	sent := stubSMTP(t)
+	expiresAt := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+	if err := remind("abc123", notification, expiresAt); err != nil {
+		t.Fatal(err)
+	}
+
+	m := only(t, *sent)
+	if got := m.msg.Header.Get("Subject"); got != "report.pdf expires soon" {
+		t.Errorf("Subject = %q", got)
+	}
+	assertBody(t, m.body, "will self-destruct at Wed, 02 Jan 2030 15:04:05 UTC", notification.URL)
+}
+
+func TestSubjectCannotAddHeaders(t *testing.T) {
+	sent := stubSMTP(t)
+	n := notification
+	n.FileName = "x\r\nBcc: victim@example.com"
+	if err := notifyUploader(n, storage.Event{Type: storage.EventDestroyed}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := only(t, *sent)
+	if bcc := m.msg.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("file name injected Bcc: %q", bcc)
+	}
+}
+
+func TestLongFileNameIsShortened(t *testing.T) {
+	sent := stubSMTP(t)
+	n := notification
+	n.FileName = strings.Repeat("free money ", 50) + "\t.pdf"
+	if err := notifyUploader(n, storage.Event{Type: storage.EventDestroyed}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := only(t, *sent)
+	name := strings.TrimSuffix(m.msg.Header.Get("Subject"), " has self-destructed")
+	if len([]rune(name)) != maxFileName || !strings.HasSuffix(name, "...") {
+		t.Errorf("file name in subject = %q, want %d characters ending in ...", name, maxFileName)
+	}
+	if strings.Contains(m.body, "\t") {
+		t.Error("tab from the file name reached the body")
+	}
+}
+
+func TestCustomTemplate(t *testing.T) {
+	dir := t.TempDir()
+	custom := "Subject: Heads up: {{.FileName}}\n\nGone soon: {{.URL}}\n"
+	if err := os.WriteFile(filepath.Join(dir, TemplateExpiring+".txt"), []byte(custom), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MAIL_TEMPLATE_DIR", dir)
+	sent := stubSMTP(t)
+	if err := remind("abc123", notification, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	m := only(t, *sent)
+	if got := m.msg.Header.Get("Subject"); got != "Heads up: report.pdf" {
+		t.Errorf("Subject = %q", got)
+	}
+	assertBody(t, m.body, "Gone soon: "+notification.URL)
+}
@@ -2,16 +2,25 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/Morizz00/self-destruct-share-api/geoip"
 	"github.com/Morizz00/self-destruct-share-api/handlers"
+	"github.com/Morizz00/self-destruct-share-api/mailer"
+	"github.com/Morizz00/self-destruct-share-api/pow"
+	"github.com/Morizz00/self-destruct-share-api/storage"
+	"github.com/Morizz00/self-destruct-share-api/utils"
+	"github.com/Morizz00/self-destruct-share-api/webhooks"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -21,21 +30,58 @@ import (
 
 func main() {
 	r := chi.NewRouter()
+
+	// Only trust forwarding headers from known proxies
+	trustedProxies, err := utils.ParseCIDRs(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	// Format of generated file ids
+	if err := configureIDs(); err != nil {
+		log.Fatalf("Invalid id configuration: %v", err)
+	}
+
+	// Optional GeoIP database for country restrictions, reloaded when the file changes
+	if geoipPath := os.Getenv("GEOIP_DB_PATH"); geoipPath != "" {
+		if err := geoip.Load(geoipPath); err != nil {
+			log.Printf("WARNING: GeoIP database not loaded: %v", err)
+		} else {
+			log.Printf("GeoIP database loaded: %s", geoipPath)
+		}
+		go geoip.Watch(geoipPath, time.Minute)
+	}
+
+	// Report expired files as lifecycle events
+	go storage.SweepExpiries(5 * time.Second)
+	go webhooks.Run()
+
+	// Email notifications over SMTP
+	if err := mailer.Load(); err != nil {
+		log.Fatalf("Invalid mail configuration: %v", err)
+	}
+	if mailer.Enabled() {
+		go mailer.Run()
+	}
+
+	// Optional proof-of-work challenge against id enumeration
+	if err := pow.Load(); err != nil {
+		log.Fatalf("Invalid proof-of-work configuration: %v", err)
+	}
 	
 	// Structured logging middleware
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(realIP(trustedProxies))
 	r.Use(structuredLogger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
 
 	// CORS configuration - restrict to specific origins
 	allowedOrigins := getCORSOrigins()
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   allowedOrigins,
-		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link", "X-File-Name", "X-File-Size", "X-Downloads-Left"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-File-Name", pow.Header},
+		ExposedHeaders:   []string{"Link", "X-File-Name", "X-File-Size", "X-Downloads-Left", "X-File-Id", "X-Created-At", "X-Expires-At", "X-Last-Accessed-At", "X-Download-Count", "X-Sender-Message"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
@@ -52,19 +98,47 @@ func main() {
 
 	// API routes with stricter rate limiting for uploads
 	r.Group(func(r chi.Router) {
+		r.Use(middleware.Timeout(60 * time.Second))
+
 		// Upload endpoint: 10 requests per minute per IP
 		r.With(httprate.LimitByIP(10, 1*time.Minute)).Post("/upload", handlers.Upload)
-		r.Get("/file/{id}", handlers.DownloadFile)
-		r.Get("/preview/{id}", handlers.Preview)
-		r.Get("/meta/{id}", handlers.GetMeta)
+		r.With(pow.Require).Get("/file/{id}", handlers.DownloadFile)
+		r.With(pow.Require).Get("/file/{id}/*", handlers.DownloadBundleMember)
+		r.Delete("/file/{id}", handlers.RevokeFile)
+		r.With(httprate.LimitByIP(10, 1*time.Minute)).Post("/file/{id}/verify", handlers.RequestVerificationCode)
+		r.With(httprate.LimitByIP(10, 1*time.Minute)).Post("/file/{id}/verify/confirm", handlers.ConfirmVerificationCode)
+		r.With(pow.Require).Get("/preview/{id}", handlers.Preview)
+		r.With(pow.Require).Get("/meta/{id}", handlers.GetMeta)
+		r.With(httprate.LimitByIP(10, 1*time.Minute)).Post("/secret", handlers.CreateSecret)
+		r.Get("/secret/{id}", handlers.RevealSecret)
+
+		// File requests: inbox links for receiving uploads
+		r.With(httprate.LimitByIP(10, 1*time.Minute)).Post("/request", handlers.CreateRequest)
+		r.With(httprate.LimitByIP(10, 1*time.Minute)).Post("/request/{id}/upload", handlers.UploadToRequest)
+		r.Get("/request/{id}/files", handlers.ListRequestFiles)
+
+		// Short-code transfers: PAKE mailboxes
+		r.With(httprate.LimitByIP(10, 1*time.Minute)).Post("/mailbox", handlers.CreateMailbox)
+		r.Get("/mailbox/words", handlers.MailboxWords)
+		r.Post("/mailbox/{nameplate}/messages", handlers.PostMailboxMessage)
+		r.Get("/mailbox/{nameplate}/messages", handlers.GetMailboxMessages)
+		r.Delete("/mailbox/{nameplate}", handlers.CloseMailbox)
 	})
 
+	// Live status for uploaders, streamed as server-sent events
+	r.Get("/file/{id}/events", handlers.FileEvents)
+
+	// Live relay: streams run as long as data flows, so they manage their
+	// own deadlines instead of the request timeout
+	r.With(httprate.LimitByIP(10, 1*time.Minute)).Put("/relay/{id}", handlers.RelaySend)
+	r.Get("/relay/{id}", handlers.RelayReceive)
+
 	// Static file serving
 	workDir, _ := os.Getwd()
 	log.Printf("Working directory: %s", workDir)
 	
 	// Check if static files exist
-	staticFiles := []string{"index.html", "download.html", "styles.css", "script.js"}
+	staticFiles := []string{"index.html", "download.html", "secret.html", "styles.css", "script.js", "pow.js"}
 	for _, file := range staticFiles {
 		path := filepath.Join(workDir, file)
 		if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -79,6 +153,9 @@ func main() {
 	r.Get("/download.html", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, filepath.Join(workDir, "download.html"))
 	})
+	r.Get("/secret.html", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join(workDir, "secret.html"))
+	})
 	r.Get("/styles.css", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/css")
 		http.ServeFile(w, r, filepath.Join(workDir, "styles.css"))
@@ -87,6 +164,10 @@ func main() {
 		w.Header().Set("Content-Type", "application/javascript")
 		http.ServeFile(w, r, filepath.Join(workDir, "script.js"))
 	})
+	r.Get("/pow.js", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript")
+		http.ServeFile(w, r, filepath.Join(workDir, "pow.js"))
+	})
 	r.Handle("/static/*", http.StripPrefix("/static/", fs))
 
 	// Get port from environment variable or use 8000 as default (Koyeb default)
@@ -128,6 +209,18 @@ func main() {
 	log.Println("Server exited")
 }
 
+// realIP replaces RemoteAddr with the resolved client IP so that rate
+// limiting, logging and IP-based access rules all see the same address.
+// Forwarding headers are only honored when the peer is a trusted proxy.
+func realIP(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.RemoteAddr = utils.ClientIP(r, trusted)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // structuredLogger provides structured logging middleware
 func structuredLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -136,9 +229,15 @@ func structuredLogger(next http.Handler) http.Handler {
 
 		next.ServeHTTP(ww, r)
 
+		country := geoip.Country(utils.RequestIP(r))
+		if country == "" {
+			country = "-"
+		}
+
 		log.Printf(
-			"%s %s %s %d %d %s %s",
+			"%s %s %s %s %d %d %s %s",
 			r.RemoteAddr,
+			country,
 			r.Method,
 			r.URL.Path,
 			ww.Status(),
@@ -149,6 +248,24 @@ func structuredLogger(next http.Handler) http.Handler {
 	})
 }
 
+// configureIDs sets the generated id format from ID_FORMAT, ID_LENGTH and
+// ID_CHECKSUM
+func configureIDs() error {
+	format := os.Getenv("ID_FORMAT")
+	if format == "" {
+		format = utils.IDFormatHex
+	}
+	length := 0
+	if raw := os.Getenv("ID_LENGTH"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("ID_LENGTH must be a number: %w", err)
+		}
+		length = n
+	}
+	return utils.SetIDFormat(format, length, os.Getenv("ID_CHECKSUM") == "true")
+}
+
 // getCORSOrigins returns allowed CORS origins from environment or defaults
 func getCORSOrigins() []string {
 	corsEnv := os.Getenv("CORS_ORIGINS")
@@ -0,0 +1,216 @@
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/bits"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Morizz00/self-destruct-share-api/storage"
+	"github.com/Morizz00/self-destruct-share-api/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	// Header carries a solved challenge: the challenge, a colon and the
+	// counter. Clients that can't set headers use the "pow" query parameter.
+	Header = "X-Proof-Of-Work"
+
+	defaultDifficulty    = 16
+	defaultMaxDifficulty = 22
+	challengeLifetime    = 5 * time.Minute
+	// failureStep is how many missing-file lookups over two minutes add
+	// one bit of difficulty; every doubling adds another
+	failureStep = 200
+	// difficultyCache is how long the failure rate is reused between
+	// challenges
+	difficultyCache = 5 * time.Second
+)
+
+type config struct {
+	secret        []byte
+	difficulty    int
+	maxDifficulty int
+}
+
+var (
+	cfg config
+
+	cachedDifficulty int
+	cachedAt         time.Time
+	cacheMu          sync.Mutex
+)
+
+// Challenge is sent with 428 Precondition Required when a request needs a
+// proof of work
+type Challenge struct {
+	Challenge  string `json:"challenge"`
+	Difficulty int    `json:"difficulty"`
+	ExpiresAt  string `json:"expires_at"`
+}
+
+// Load reads the proof-of-work settings. Challenges stay disabled when
+// POW_SECRET is not set; every instance must share the same secret.
+func Load() error {
+	cfg = config{
+		secret:        []byte(os.Getenv("POW_SECRET")),
+		difficulty:    defaultDifficulty,
+		maxDifficulty: defaultMaxDifficulty,
+	}
+	if raw := os.Getenv("POW_DIFFICULTY"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 32 {
+			return errors.New("POW_DIFFICULTY must be between 1 and 32 bits")
+		}
+		cfg.difficulty = n
+	}
+	if raw := os.Getenv("POW_MAX_DIFFICULTY"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < cfg.difficulty || n > 32 {
+			return errors.New("POW_MAX_DIFFICULTY must be between POW_DIFFICULTY and 32 bits")
+		}
+		cfg.maxDifficulty = n
+	} else if cfg.maxDifficulty < cfg.difficulty {
+		cfg.maxDifficulty = cfg.difficulty
+	}
+	if len(cfg.secret) > 0 && len(cfg.secret) < 32 {
+		return errors.New("POW_SECRET must be at least 32 characters")
+	}
+	return nil
+}
+
+// Enabled reports whether requests need a proof of work
+func Enabled() bool {
+	return len(cfg.secret) > 0
+}
+
+// Require gates a handler for the {id} route parameter behind a solved
+// challenge. Challenges are bound to the id and the client address, so
+// one solution can't be reused to probe other ids. Lookups of missing
+// files raise the difficulty for everyone.
+func Require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id := chi.URLParam(r, "id")
+		ip := utils.RequestIP(r).String()
+		solution := r.Header.Get(Header)
+		if solution == "" {
+			solution = r.URL.Query().Get("pow")
+		}
+		if !verify(solution, id, ip, time.Now()) {
+			writeChallenge(w, id, ip)
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		if ww.Status() == http.StatusNotFound {
+			if err := storage.RecordLookupFailure(); err != nil {
+				log.Printf("Proof of work: failed to record lookup failure: %v", err)
+			}
+		}
+	})
+}
+
+// writeChallenge answers with a new challenge at the current difficulty
+func writeChallenge(w http.ResponseWriter, id, ip string) {
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		http.Error(w, "Failed to create challenge", http.StatusInternalServerError)
+		return
+	}
+	difficulty := currentDifficulty()
+	expiresAt := time.Now().Add(challengeLifetime)
+	payload := fmt.Sprintf("%d.%d.%s", expiresAt.Unix(), difficulty, base64.RawURLEncoding.EncodeToString(nonce))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPreconditionRequired)
+	json.NewEncoder(w).Encode(Challenge{
+		Challenge:  payload + "." + sign(payload, id, ip),
+		Difficulty: difficulty,
+		ExpiresAt:  expiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// verify checks a "challenge:counter" solution: the challenge must carry
+// our signature for this id and address, be unexpired, and the SHA-256 of
+// the whole solution must start with difficulty zero bits
+func verify(solution, id, ip string, now time.Time) bool {
+	challenge, counter, ok := strings.Cut(solution, ":")
+	if !ok || counter == "" || len(counter) > 20 {
+		return false
+	}
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 4 {
+		return false
+	}
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(sign(payload, id, ip))) {
+		return false
+	}
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+	difficulty, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	sum := sha256.Sum256([]byte(solution))
+	return leadingZeroBits(sum[:]) >= difficulty
+}
+
+func sign(payload, id, ip string) string {
+	mac := hmac.New(sha256.New, cfg.secret)
+	mac.Write([]byte(payload + "|" + id + "|" + ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func leadingZeroBits(sum []byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// currentDifficulty adds a bit to the base difficulty for every doubling
+// of recent missing-file lookups past failureStep
+func currentDifficulty() int {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if time.Since(cachedAt) < difficultyCache {
+		return cachedDifficulty
+	}
+
+	difficulty := cfg.difficulty
+	failures, err := storage.RecentLookupFailures()
+	if err != nil {
+		log.Printf("Proof of work: failed to read lookup failures: %v", err)
+	}
+	difficulty += bits.Len64(uint64(failures / failureStep))
+	if difficulty > cfg.maxDifficulty {
+		difficulty = cfg.maxDifficulty
+	}
+	cachedDifficulty, cachedAt = difficulty, time.Now()
+	return difficulty
+}
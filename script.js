@@ -313,7 +313,7 @@ async function handleDownload(event) {
             url += `?password=${encodeURIComponent(password)}`;
         }
         
-        const response = await fetch(url);
+        const response = await powFetch(fileId, url);
         
         if (!response.ok) {
             if (response.status === 404) {
@@ -1044,7 +1044,7 @@ async function previewFile(fileId, password=' '){
             url += `?password=${encodeURIComponent(password)}`;
         }
         
-        const response = await fetch(url);
+        const response = await powFetch(fileId, url);
         
         if (!response.ok) {
             if (response.status === 403) {
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// eventsPrefix namespaces the pub/sub channel of each file, so every
+// replica can fan events out to its own subscribers
+const eventsPrefix = "events:"
+
+// EventStream is the Redis Stream every event is appended to, for other
+// services to consume with consumer groups. It is trimmed to roughly
+// eventStreamMaxLen entries.
+const (
+	EventStream       = "events:stream"
+	eventStreamMaxLen = 100000
+)
+
+const (
+	EventUploaded       = "uploaded"
+	EventPreviewed      = "previewed"
+	EventDownloaded     = "downloaded"
+	EventPasswordFailed = "password_failed"
+	EventRevoked        = "revoked"
+	EventExpired        = "expired"
+	EventDestroyed      = "destroyed"
+)
+
+// Event is something that happened to a stored file
+type Event struct {
+	Type          string    `json:"type"`
+	FileID        string    `json:"file_id"`
+	DownloadsLeft int       `json:"downloads_left"`
+	Recipient     string    `json:"recipient,omitempty"`
+	Time          time.Time `json:"time"`
+}
+
+// IsFinalEvent reports whether an event type means the file is gone
+func IsFinalEvent(eventType string) bool {
+	return eventType == EventDestroyed || eventType == EventRevoked || eventType == EventExpired
+}
+
+// PublishEvent appends event to the event stream and publishes it to the
+// file's subscribers. Stream entries always carry the same fields, empty
+// when they don't apply.
+func PublishEvent(event Event) error {
+	u, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: EventStream,
+			MaxLen: eventStreamMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{
+				"type":           event.Type,
+				"file_id":        event.FileID,
+				"downloads_left": event.DownloadsLeft,
+				"recipient":      event.Recipient,
+				"time":           event.Time.UTC().Format(time.RFC3339Nano),
+			},
+		})
+		pipe.Publish(ctx, eventsPrefix+event.FileID, u)
+		return nil
+	})
+	return err
+}
+
+// SubscribeEvents subscribes to the events of a file. The subscription is
+// confirmed before it is returned, so no later event is missed.
+func SubscribeEvents(c context.Context, id string) (*redis.PubSub, error) {
+	sub := rdb.Subscribe(c, eventsPrefix+id)
+	if _, err := sub.Receive(c); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// StreamEvent is an event read from EventStream through a consumer group
+type StreamEvent struct {
+	StreamID string
+	Event
+}
+
+// EnsureEventGroup creates a consumer group on EventStream that starts
+// with events added from now on
+func EnsureEventGroup(group string) error {
+	err := rdb.XGroupCreateMkStream(ctx, EventStream, group, "$").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// ReadEventGroup blocks for up to block waiting for events not yet handed
+// to any consumer of group
+func ReadEventGroup(group, consumer string, count int64, block time.Duration) ([]StreamEvent, error) {
+	streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{EventStream, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var events []StreamEvent
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			events = append(events, StreamEvent{StreamID: msg.ID, Event: parseStreamEvent(msg.Values)})
+		}
+	}
+	return events, nil
+}
+
+// ClaimStaleEvents takes over up to count events of group that were read
+// but not acknowledged within minIdle, by this consumer or a crashed one
+func ClaimStaleEvents(group, consumer string, minIdle time.Duration, count int64) ([]StreamEvent, error) {
+	msgs, _, err := rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   EventStream,
+		Group:    group,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Start:    "0",
+		Count:    count,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]StreamEvent, 0, len(msgs))
+	for _, msg := range msgs {
+		events = append(events, StreamEvent{StreamID: msg.ID, Event: parseStreamEvent(msg.Values)})
+	}
+	return events, nil
+}
+
+func AckEvent(group, streamID string) error {
+	return rdb.XAck(ctx, EventStream, group, streamID).Err()
+}
+
+func parseStreamEvent(values map[string]interface{}) Event {
+	field := func(name string) string {
+		s, _ := values[name].(string)
+		return s
+	}
+	event := Event{
+		Type:      field("type"),
+		FileID:    field("file_id"),
+		Recipient: field("recipient"),
+	}
+	event.DownloadsLeft, _ = strconv.Atoi(field("downloads_left"))
+	event.Time, _ = time.Parse(time.RFC3339Nano, field("time"))
+	return event
+}
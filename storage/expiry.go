@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// expiryIndex is a sorted set of stored file ids scored by when they
+// expire. Redis drops expired keys silently, so the sweeper uses it to
+// notice expiries and report them as events.
+const expiryIndex = "index:expiries"
+
+// sweepBatch bounds how many due ids one sweep handles
+const sweepBatch = 100
+
+// createWithExpiry stores a new key and records its expiry in one step.
+// It returns 0, storing nothing, when the key is taken.
+var createWithExpiry = redis.NewScript(`
+if not redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 0
+end
+redis.call('ZADD', KEYS[2], ARGV[3], KEYS[1])
+return 1
+`)
+
+// SweepExpiries reports expired files every interval until the process
+// exits. Every replica may run it; removing an id from the index claims
+// it, so each expiry is reported once.
+func SweepExpiries(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := sweepExpired(time.Now()); err != nil {
+			log.Printf("Expiry sweep error: %v", err)
+		}
+	}
+}
+
+func sweepExpired(now time.Time) error {
+	due, err := rdb.ZRangeByScore(ctx, expiryIndex, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: sweepBatch,
+	}).Result()
+	if err != nil {
+		return err
+	}
+	for _, id := range due {
+		claimed, err := rdb.ZRem(ctx, expiryIndex, id).Result()
+		if err != nil {
+			return err
+		}
+		if claimed == 0 {
+			continue
+		}
+		// Redis' clock may lag ours; sweep again once the key is gone
+		ttl, err := rdb.PTTL(ctx, id).Result()
+		if err != nil {
+			return err
+		}
+		if ttl > 0 {
+			rdb.ZAdd(ctx, expiryIndex, redis.Z{Score: float64(now.Add(ttl).UnixMilli()), Member: id})
+			continue
+		}
+		log.Printf("File expired: id=%s", id)
+		if err := PublishEvent(Event{Type: EventExpired, FileID: id, Time: now.UTC()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
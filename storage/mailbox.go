@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// mailboxPrefix namespaces PAKE mailboxes. Each mailbox uses three keys
+// sharing one expiry: the nameplate record, the set of sides that joined
+// and the message list.
+const mailboxPrefix = "mailbox:"
+
+// ErrNoNameplate is returned when no free nameplate was found
+var ErrNoNameplate = errors.New("no free nameplate")
+
+// nameplateAttempts bounds the random picks one allocation tries
+const nameplateAttempts = 16
+
+// Mailbox is the server's view of a short-code transfer. The server only
+// knows the nameplate; the code words and the key derived from them stay
+// with the clients.
+type Mailbox struct {
+	Nameplate int       `json:"nameplate"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// MailboxMessage is an opaque message posted by one side of a mailbox
+type MailboxMessage struct {
+	Side      string    `json:"side"`
+	Phase     string    `json:"phase"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func mailboxKey(nameplate int) string {
+	return mailboxPrefix + strconv.Itoa(nameplate)
+}
+
+// AllocateMailbox claims a random free nameplate up to max. It gives up
+// with ErrNoNameplate after a few taken picks instead of scanning every
+// nameplate.
+func AllocateMailbox(max int, expiry time.Duration) (Mailbox, error) {
+	now := time.Now()
+	for range nameplateAttempts {
+		n := rand.IntN(max) + 1
+		mailbox := Mailbox{Nameplate: n, CreatedAt: now, ExpiresAt: now.Add(expiry)}
+		u, err := json.Marshal(mailbox)
+		if err != nil {
+			return Mailbox{}, err
+		}
+		ok, err := rdb.SetNX(ctx, mailboxKey(n), u, expiry).Result()
+		if err != nil {
+			return Mailbox{}, err
+		}
+		if ok {
+			return mailbox, nil
+		}
+	}
+	return Mailbox{}, ErrNoNameplate
+}
+
+// CountMailboxCreation counts a mailbox created by ip and returns how many
+// it created in the current window
+func CountMailboxCreation(ip string, window time.Duration) (int64, error) {
+	key := mailboxPrefix + "ip:" + ip
+	var count *redis.IntCmd
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		count = pipe.Incr(ctx, key)
+		pipe.ExpireNX(ctx, key, window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
+
+func GetMailbox(nameplate int) (Mailbox, error) {
+	val, err := rdb.Get(ctx, mailboxKey(nameplate)).Bytes()
+	if err != nil {
+		return Mailbox{}, err
+	}
+	var res Mailbox
+	err = json.Unmarshal(val, &res)
+	return res, err
+}
+
+// JoinMailbox records side as a participant. It reports false when the
+// mailbox already has maxSides other participants.
+func JoinMailbox(mailbox Mailbox, side string, maxSides int) (bool, error) {
+	key := mailboxKey(mailbox.Nameplate) + ":sides"
+	var added *redis.IntCmd
+	var count *redis.IntCmd
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		added = pipe.SAdd(ctx, key, side)
+		count = pipe.SCard(ctx, key)
+		pipe.ExpireAt(ctx, key, mailbox.ExpiresAt)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if count.Val() > int64(maxSides) {
+		if added.Val() == 1 {
+			rdb.SRem(ctx, key, side)
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// AppendMailboxMessage adds msg to the mailbox and returns the number of
+// messages it now holds
+func AppendMailboxMessage(mailbox Mailbox, msg MailboxMessage) (int64, error) {
+	u, err := json.Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+	key := mailboxKey(mailbox.Nameplate) + ":messages"
+	var count *redis.IntCmd
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		count = pipe.RPush(ctx, key, u)
+		pipe.ExpireAt(ctx, key, mailbox.ExpiresAt)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
+
+// MailboxMessages returns the messages posted after the first skip ones
+func MailboxMessages(nameplate int, skip int64) ([]MailboxMessage, error) {
+	vals, err := rdb.LRange(ctx, mailboxKey(nameplate)+":messages", skip, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]MailboxMessage, 0, len(vals))
+	for _, val := range vals {
+		var msg MailboxMessage
+		if err := json.Unmarshal([]byte(val), &msg); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// IsMailboxSide reports whether side has joined the mailbox
+func IsMailboxSide(nameplate int, side string) (bool, error) {
+	return rdb.SIsMember(ctx, mailboxKey(nameplate)+":sides", side).Result()
+}
+
+func DeleteMailbox(nameplate int) error {
+	key := mailboxKey(nameplate)
+	return rdb.Del(ctx, key, key+":sides", key+":messages").Err()
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// notifyPrefix holds an uploader's email settings for a file. Like
+	// webhooks they outlive the file.
+	notifyPrefix = "notify:"
+	// reminderIndex is a sorted set of file ids scored by when to send
+	// their pre-expiry reminder
+	reminderIndex = "notify:reminders"
+	// linkEmailPrefix counts emailed links per address, and in total
+	// under linkEmailPrefix+"all"
+	linkEmailPrefix = "notify:sent:"
+)
+
+// Notification is where and how to tell an uploader about their file
+type Notification struct {
+	Email    string `json:"email"`
+	FileName string `json:"filename"`
+	URL      string `json:"url"`
+}
+
+func StoreNotification(id string, n Notification, expiry time.Duration) error {
+	u, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return rdb.Set(ctx, notifyPrefix+id, u, expiry).Err()
+}
+
+func GetNotification(id string) (Notification, error) {
+	val, err := rdb.Get(ctx, notifyPrefix+id).Bytes()
+	if err != nil {
+		return Notification{}, err
+	}
+	var res Notification
+	err = json.Unmarshal(val, &res)
+	return res, err
+}
+
+// DeleteNotification drops a file's email settings and pending reminder
+func DeleteNotification(id string) error {
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, notifyPrefix+id)
+		pipe.ZRem(ctx, reminderIndex, id)
+		return nil
+	})
+	return err
+}
+
+// reserveLinkEmails counts ARGV[1] emails against both keys unless that
+// would take either over its limit, so refused requests use up nothing
+var reserveLinkEmails = redis.NewScript(`
+local n = tonumber(ARGV[1])
+if tonumber(redis.call('GET', KEYS[1]) or '0') + n > tonumber(ARGV[2]) or
+   tonumber(redis.call('GET', KEYS[2]) or '0') + n > tonumber(ARGV[3]) then
+	return 0
+end
+for _, key in ipairs(KEYS) do
+	if redis.call('INCRBY', key, n) == n then
+		redis.call('PEXPIRE', key, ARGV[4])
+	end
+end
+return 1
+`)
+
+// ReserveLinkEmails counts n emailed links sent for ip. It reports false,
+// counting nothing, when ip or the server as a whole would send more than
+// perIP or total within window.
+func ReserveLinkEmails(ip string, n, perIP, total int64, window time.Duration) (bool, error) {
+	ok, err := reserveLinkEmails.Run(ctx, rdb, []string{linkEmailPrefix + ip, linkEmailPrefix + "all"},
+		n, perIP, total, window.Milliseconds()).Int()
+	return ok == 1, err
+}
+
+func ScheduleReminder(id string, at time.Time) error {
+	return rdb.ZAdd(ctx, reminderIndex, redis.Z{Score: float64(at.UnixMilli()), Member: id}).Err()
+}
+
+// ClaimDueReminders takes up to count file ids whose reminder is due.
+// Removing an id from the index claims it for this server.
+func ClaimDueReminders(now time.Time, count int64) ([]string, error) {
+	due, err := rdb.ZRangeByScore(ctx, reminderIndex, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: count,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	var claimed []string
+	for _, id := range due {
+		removed, err := rdb.ZRem(ctx, reminderIndex, id).Result()
+		if err != nil {
+			return claimed, err
+		}
+		if removed == 1 {
+			claimed = append(claimed, id)
+		}
+	}
+	return claimed, nil
+}
+
+// TTL returns how long a stored file has left, or a negative duration if
+// it is gone
+func TTL(key string) (time.Duration, error) {
+	return rdb.PTTL(ctx, key).Result()
+}
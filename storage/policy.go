@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrFileGone is returned when a file was destroyed or expired while it
+// was being accessed
+var ErrFileGone = errors.New("file no longer exists")
+
+// ErrNoDownloadsLeft is returned when concurrent downloads used up the
+// budget first
+var ErrNoDownloadsLeft = errors.New("no downloads remaining")
+
+// maxAccessRetries bounds how often an access is retried while concurrent
+// accesses keep changing the file
+const maxAccessRetries = 10
+
+// UpdateFileAfterAccess re-reads file key after a successful download or
+// preview, applies change to it and stores the result, applying its
+// expiry policy:
+//   - sliding files get a fresh idle window, capped at their absolute maximum
+//   - fuse files are cut down to the fuse length on first access
+//   - fixed files keep their stored expiry untouched
+//
+// The read and the write form one WATCH transaction that is retried when
+// another access changes the file in between, so concurrent downloads
+// never undo each other's counts. change may be nil; it runs on every
+// fresh copy. A file whose DownloadsLeft reaches zero is deleted instead,
+// and destroyed reports that.
+//
+// On success file holds what was stored, with LastAccessedAt and ExpiresAt
+// updated. The file is never re-created: ErrFileGone is returned when it no
+// longer exists, or when its idle window or fuse has already run out.
+func UpdateFileAfterAccess(key string, file *StoredFile, change func(*StoredFile) error) (destroyed bool, err error) {
+	for range maxAccessRetries {
+		var expired *StoredFile
+		err = rdb.Watch(ctx, func(tx *redis.Tx) error {
+			var fresh StoredFile
+			destroyed, expired, err = accessFile(tx, key, &fresh, change)
+			if err == nil {
+				*file = fresh
+			}
+			return err
+		}, key)
+		if expired != nil {
+			PublishEvent(Event{Type: EventExpired, FileID: key, DownloadsLeft: expired.DownloadsLeft, Time: time.Now().UTC()})
+			return false, ErrFileGone
+		}
+		if !errors.Is(err, redis.TxFailedErr) {
+			return destroyed, err
+		}
+	}
+	return false, err
+}
+
+// accessFile is one attempt of UpdateFileAfterAccess inside its WATCH.
+// expired is set when the file was deleted because its cap had passed.
+func accessFile(tx *redis.Tx, key string, file *StoredFile, change func(*StoredFile) error) (destroyed bool, expired *StoredFile, err error) {
+	val, err := tx.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return false, nil, ErrFileGone
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	if err := json.Unmarshal(val, file); err != nil {
+		return false, nil, err
+	}
+	ttl, err := tx.PTTL(ctx, key).Result()
+	if err != nil {
+		return false, nil, err
+	}
+	if ttl <= 0 {
+		return false, nil, ErrFileGone
+	}
+	if change != nil {
+		if err := change(file); err != nil {
+			return false, nil, err
+		}
+	}
+
+	keepExpiry := true
+	switch {
+	case file.IdleTimeout > 0:
+		ttl = file.IdleTimeout
+		if remaining := time.Until(file.MaxExpiresAt); remaining < ttl {
+			ttl = remaining
+		}
+		keepExpiry = false
+	case file.Fuse > 0 && !file.FuseLit:
+		file.FuseLit = true
+		if ttl > file.Fuse {
+			ttl = file.Fuse
+			keepExpiry = false
+		}
+	}
+	if ttl <= 0 || file.DownloadsLeft <= 0 {
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			pipe.ZRem(ctx, expiryIndex, key)
+			return nil
+		})
+		if err != nil {
+			return false, nil, err
+		}
+		if ttl <= 0 {
+			return false, file, nil
+		}
+		return true, nil, nil
+	}
+
+	now := time.Now()
+	file.LastAccessedAt = now
+	if !keepExpiry {
+		file.ExpiresAt = now.Add(ttl)
+	}
+	u, err := json.Marshal(file)
+	if err != nil {
+		return false, nil, err
+	}
+	var set *redis.StatusCmd
+	_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if keepExpiry {
+			set = pipe.SetArgs(ctx, key, u, redis.SetArgs{Mode: "XX", KeepTTL: true})
+			return nil
+		}
+		set = pipe.SetArgs(ctx, key, u, redis.SetArgs{Mode: "XX", TTL: ttl})
+		pipe.ZAdd(ctx, expiryIndex, redis.Z{Score: float64(file.ExpiresAt.UnixMilli()), Member: key})
+		return nil
+	})
+	if errors.Is(err, redis.Nil) || errors.Is(set.Err(), redis.Nil) {
+		return false, nil, ErrFileGone
+	}
+	return false, nil, err
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// powFailuresPrefix counts lookups of missing files per minute, shared by
+// all instances
+const powFailuresPrefix = "pow:failures:"
+
+func powFailuresKey(t time.Time) string {
+	return powFailuresPrefix + strconv.FormatInt(t.Unix()/60, 10)
+}
+
+// RecordLookupFailure counts a request for a file that doesn't exist
+func RecordLookupFailure() error {
+	key := powFailuresKey(time.Now())
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, 2*time.Minute)
+		return nil
+	})
+	return err
+}
+
+// RecentLookupFailures returns the failed lookups of the current and the
+// previous minute
+func RecentLookupFailures() (int64, error) {
+	now := time.Now()
+	counts, err := rdb.MGet(ctx, powFailuresKey(now), powFailuresKey(now.Add(-time.Minute))).Result()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, count := range counts {
+		if s, ok := count.(string); ok {
+			n, _ := strconv.ParseInt(s, 10, 64)
+			total += n
+		}
+	}
+	return total, nil
+}
@@ -54,12 +54,16 @@ func cleanRedisURL(url string) string {
 	return strings.TrimSpace(url)
 }
 
-func StoreFile(key string, file StoredFile, expiry time.Duration) error {
+// CreateFile stores a new file, reporting false instead of overwriting
+// when the key is already taken
+func CreateFile(key string, file StoredFile, expiry time.Duration) (bool, error) {
 	u, err := json.Marshal(file)
 	if err != nil {
-		return err
+		return false, err
 	}
-	return rdb.Set(ctx, key, u, expiry).Err()
+	created, err := createWithExpiry.Run(ctx, rdb, []string{key, expiryIndex},
+		u, expiry.Milliseconds(), time.Now().Add(expiry).UnixMilli()).Int()
+	return created == 1, err
 }
 
 //	func GetAndDelete(key string) (StoredFile, error) {
@@ -81,16 +85,10 @@ func Get(key string) (StoredFile, error) {
 	return res, err
 }
 func Delete(key string) error {
-	return rdb.Del(ctx, key).Err()
-}
-func UpdateFilePreservingTTL(key string, file StoredFile) error {
-	u, err := json.Marshal(file)
-	if err != nil {
-		return err
-	}
-	ttl, err := rdb.TTL(ctx, key).Result()
-	if err != nil || ttl <= 0 {
-		ttl = time.Minute * 5
-	}
-	return rdb.Set(ctx, key, u, ttl).Err()
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.ZRem(ctx, expiryIndex, key)
+		return nil
+	})
+	return err
 }
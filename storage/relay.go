@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// relayPrefix namespaces relay rendezvous records
+const relayPrefix = "relay:"
+
+// Relay is the rendezvous record of a sender waiting to stream a file to a
+// receiver. The file itself is never stored.
+type Relay struct {
+	FileName  string    `json:"filename"`
+	MIME      string    `json:"mime"`
+	Size      int64     `json:"size"`
+	Password  string    `json:"password,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ReserveRelay stores relay under id unless the id is already taken. It
+// reports whether the reservation succeeded.
+func ReserveRelay(id string, relay Relay, expiry time.Duration) (bool, error) {
+	u, err := json.Marshal(relay)
+	if err != nil {
+		return false, err
+	}
+	return rdb.SetNX(ctx, relayPrefix+id, u, expiry).Result()
+}
+
+func GetRelay(id string) (Relay, error) {
+	val, err := rdb.Get(ctx, relayPrefix+id).Bytes()
+	if err != nil {
+		return Relay{}, err
+	}
+	var res Relay
+	err = json.Unmarshal(val, &res)
+	return res, err
+}
+
+func DeleteRelay(id string) error {
+	return rdb.Del(ctx, relayPrefix+id).Err()
+}
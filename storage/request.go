@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// requestPrefix namespaces file request records so their ids can't clash
+// with stored files
+const requestPrefix = "request:"
+
+// ErrRequestFull is returned when every upload slot of a request is taken
+var ErrRequestFull = errors.New("file request is full")
+
+// FileRequest is an inbox link that lets outsiders upload files which only
+// the requester can download
+type FileRequest struct {
+	Label      string    `json:"label,omitempty"`
+	OwnerToken string    `json:"owner_token"`
+	MaxUploads int       `json:"max_uploads"`
+	MaxSize    int64     `json:"max_size"`
+	Downloads  int       `json:"downloads"`
+	PublicKey  string    `json:"public_key,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// CreateRequest stores a new file request, reporting false instead of
+// overwriting when the id is already taken
+func CreateRequest(id string, req FileRequest, expiry time.Duration) (bool, error) {
+	u, err := json.Marshal(req)
+	if err != nil {
+		return false, err
+	}
+	return rdb.SetNX(ctx, requestPrefix+id, u, expiry).Result()
+}
+
+func GetRequest(id string) (FileRequest, error) {
+	val, err := rdb.Get(ctx, requestPrefix+id).Bytes()
+	if err != nil {
+		return FileRequest{}, err
+	}
+	var res FileRequest
+	err = json.Unmarshal(val, &res)
+	return res, err
+}
+
+// requestUsedKey counts the upload slots taken. It is kept next to the
+// request record so concurrent uploads can update it atomically.
+func requestUsedKey(id string) string {
+	return requestPrefix + id + ":used"
+}
+
+// requestFilesKey lists the ids of the files received
+func requestFilesKey(id string) string {
+	return requestPrefix + id + ":files"
+}
+
+// reserveUpload counts an upload against a request's limit, undoing it
+// and returning -1 when the limit is already reached. Otherwise it returns
+// the slots left.
+var reserveUpload = redis.NewScript(`
+local used = redis.call('INCR', KEYS[1])
+redis.call('PEXPIREAT', KEYS[1], ARGV[2])
+if used > tonumber(ARGV[1]) then
+	redis.call('DECR', KEYS[1])
+	return -1
+end
+return tonumber(ARGV[1]) - used
+`)
+
+// ReserveRequestUpload takes one of a request's upload slots and returns
+// how many are left, or ErrRequestFull
+func ReserveRequestUpload(id string, req FileRequest) (int, error) {
+	left, err := reserveUpload.Run(ctx, rdb, []string{requestUsedKey(id)},
+		req.MaxUploads, req.ExpiresAt.UnixMilli()).Int()
+	if err != nil {
+		return 0, err
+	}
+	if left < 0 {
+		return 0, ErrRequestFull
+	}
+	return left, nil
+}
+
+// ReleaseRequestUpload gives back a slot whose upload failed
+func ReleaseRequestUpload(id string) error {
+	return rdb.Decr(ctx, requestUsedKey(id)).Err()
+}
+
+// RequestUploadsLeft returns how many uploads a request still accepts
+func RequestUploadsLeft(id string, req FileRequest) (int, error) {
+	used, err := rdb.Get(ctx, requestUsedKey(id)).Int()
+	if errors.Is(err, redis.Nil) {
+		return req.MaxUploads, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return max(req.MaxUploads-used, 0), nil
+}
+
+// AddRequestFile records a file received through a request
+func AddRequestFile(id, fileID string, req FileRequest) error {
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, requestFilesKey(id), fileID)
+		pipe.ExpireAt(ctx, requestFilesKey(id), req.ExpiresAt)
+		return nil
+	})
+	return err
+}
+
+// RequestFileIDs lists the files received through a request, oldest first
+func RequestFileIDs(id string) ([]string, error) {
+	return rdb.LRange(ctx, requestFilesKey(id), 0, -1).Result()
+}
@@ -2,11 +2,96 @@ package storage
 
 import "time"
 
+// KindSecret marks a stored text secret; regular files leave Kind empty
+const KindSecret = "secret"
+
 type StoredFile struct {
-	FileName      string        `json:"filename"`
-	MIME          string        `json:"mime"`
-	Data          []byte        `json:"data"`
-	Password      string        `json:"password"`
-	DownloadsLeft int           `json:"downloadleft"`
-	Expiry        time.Duration `json:"expiry"`
+	Kind           string        `json:"kind,omitempty"`
+	FileName       string        `json:"filename"`
+	MIME           string        `json:"mime"`
+	Data           []byte        `json:"data"`
+	Password       string        `json:"password"`
+	DownloadsLeft  int           `json:"downloadleft"`
+	Expiry         time.Duration `json:"expiry"`
+	AllowCIDRs     []string      `json:"allow_cidrs,omitempty"`
+	AllowCountries []string      `json:"allow_countries,omitempty"`
+	AvailableFrom  time.Time     `json:"available_from"`
+	AccessWindow   string        `json:"access_window,omitempty"`
+	AccessTimezone string        `json:"access_timezone,omitempty"`
+	Fuse           time.Duration `json:"fuse,omitempty"`
+	FuseLit        bool          `json:"fuse_lit,omitempty"`
+	IdleTimeout    time.Duration `json:"idle_timeout,omitempty"`
+	MaxExpiresAt   time.Time     `json:"max_expires_at"`
+	CreatedAt      time.Time     `json:"created_at"`
+	ExpiresAt      time.Time     `json:"expires_at"`
+	LastAccessedAt time.Time     `json:"last_accessed_at"`
+	DownloadCount  int           `json:"download_count"`
+	// Recipients maps the SHA-256 of each recipient token secret to that
+	// recipient's own budget. When set, the file is only reachable
+	// through recipient links.
+	Recipients map[string]*Recipient `json:"recipients,omitempty"`
+	// Members holds the files of a multi-file bundle. Bundles have no
+	// Data of their own and are downloaded as a ZIP.
+	Members []BundleMember `json:"members,omitempty"`
+	// Message is the uploader's note for recipients, encrypted at rest
+	Message string `json:"message,omitempty"`
+	// OwnerToken is the hash of the uploader's token for following the
+	// file's events
+	OwnerToken string `json:"owner_token,omitempty"`
+	// RequestToken is the owner token hash of the file request this file
+	// was uploaded through; only that token can download it
+	RequestToken string `json:"request_token,omitempty"`
+	// Sealed marks payloads encrypted to the requester's public key, which
+	// the server can't read
+	Sealed bool `json:"sealed,omitempty"`
+	// VerifyEmails holds the hashes of the email addresses that may
+	// download the file after confirming a one-time code
+	VerifyEmails []string `json:"verify_emails,omitempty"`
+	// TOTPSecret is the base32 secret of the authenticator code required
+	// on every download
+	TOTPSecret string `json:"totp_secret,omitempty"`
+	// PGPKeys lists the fingerprints of the OpenPGP keys the payload was
+	// encrypted to
+	PGPKeys []string `json:"pgp_keys,omitempty"`
+}
+
+// BundleMember is one file inside a bundle. Name is a relative path using
+// forward slashes, preserved from folder uploads.
+type BundleMember struct {
+	Name string `json:"name"`
+	MIME string `json:"mime"`
+	Data []byte `json:"data"`
+}
+
+// IsBundle reports whether the file is a multi-file bundle
+func (f StoredFile) IsBundle() bool {
+	return len(f.Members) > 0
+}
+
+// Member looks up a bundle member by its relative path
+func (f StoredFile) Member(name string) (BundleMember, bool) {
+	for _, m := range f.Members {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return BundleMember{}, false
+}
+
+// Size returns the stored payload size, summed over members for bundles
+func (f StoredFile) Size() int {
+	size := len(f.Data)
+	for _, m := range f.Members {
+		size += len(m.Data)
+	}
+	return size
+}
+
+// Recipient is one named link to a shared file with its own download
+// budget and optional password
+type Recipient struct {
+	Label         string `json:"label"`
+	Password      string `json:"password,omitempty"`
+	DownloadsLeft int    `json:"downloadleft"`
+	DownloadCount int    `json:"download_count"`
 }
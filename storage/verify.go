@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// verifyPrefix holds one-time email codes per file and address hash
+	verifyPrefix = "verify:"
+	// accessPrefix holds the download tokens verified codes are exchanged for
+	accessPrefix = "access:"
+)
+
+var ErrTooManyAttempts = errors.New("too many attempts")
+
+func verifyKey(id, emailHash string) string {
+	return verifyPrefix + id + ":" + emailHash
+}
+
+// StoreVerificationCode replaces the pending code for an address and
+// resets its attempts. It reports false, storing nothing, when a code was
+// already sent within cooldown.
+func StoreVerificationCode(id, emailHash, codeHash string, expiry, cooldown time.Duration) (bool, error) {
+	key := verifyKey(id, emailHash)
+	ok, err := rdb.SetNX(ctx, key+":cooldown", 1, cooldown).Result()
+	if err != nil || !ok {
+		return false, err
+	}
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, codeHash, expiry)
+		pipe.Del(ctx, key+":attempts")
+		return nil
+	})
+	return err == nil, err
+}
+
+// CheckVerificationCode reports whether codeHash matches the pending code.
+// Every check counts as an attempt; past maxAttempts the code is discarded
+// and ErrTooManyAttempts returned. A matching code can only be used once.
+func CheckVerificationCode(id, emailHash, codeHash string, maxAttempts int64, expiry time.Duration) (bool, error) {
+	key := verifyKey(id, emailHash)
+	var attempts *redis.IntCmd
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		attempts = pipe.Incr(ctx, key+":attempts")
+		pipe.Expire(ctx, key+":attempts", expiry)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if attempts.Val() > maxAttempts {
+		rdb.Del(ctx, key)
+		return false, ErrTooManyAttempts
+	}
+
+	stored, err := rdb.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(codeHash)) != 1 {
+		return false, nil
+	}
+	return true, rdb.Del(ctx, key, key+":attempts").Err()
+}
+
+func StoreAccessToken(tokenHash, id string, expiry time.Duration) error {
+	return rdb.Set(ctx, accessPrefix+tokenHash, id, expiry).Err()
+}
+
+// GetAccessToken returns the id of the file an access token was issued for
+func GetAccessToken(tokenHash string) (string, error) {
+	return rdb.Get(ctx, accessPrefix+tokenHash).Result()
+}
+
+// totpPrefix records TOTP time steps already used for a file, and wrong
+// codes entered for it
+const totpPrefix = "totp:"
+
+func totpStepKey(id string, step int64) string {
+	return totpPrefix + id + ":" + strconv.FormatInt(step, 10)
+}
+
+// UseTOTPStep marks a file's TOTP step as used. It reports false if the
+// step was used before, so a code only works once.
+func UseTOTPStep(id string, step int64, expiry time.Duration) (bool, error) {
+	return rdb.SetNX(ctx, totpStepKey(id, step), 1, expiry).Result()
+}
+
+// TOTPStepUsed reports whether a file's TOTP step was already used
+func TOTPStepUsed(id string, step int64) (bool, error) {
+	n, err := rdb.Exists(ctx, totpStepKey(id, step)).Result()
+	return n > 0, err
+}
+
+func totpFailuresKey(id, ip string) string {
+	return totpPrefix + id + ":failures:" + ip
+}
+
+// TOTPFailures returns how many wrong codes ip entered for a file since
+// the failure count last expired
+func TOTPFailures(id, ip string) (int64, error) {
+	n, err := rdb.Get(ctx, totpFailuresKey(id, ip)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return n, err
+}
+
+// RecordTOTPFailure counts a wrong code from ip for a file. The count
+// expires window after the last wrong code.
+func RecordTOTPFailure(id, ip string, window time.Duration) error {
+	key := totpFailuresKey(id, ip)
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, window)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// webhookPrefix holds per-file webhook settings. They outlive the file
+	// so its expiry can still be delivered.
+	webhookPrefix = "webhook:"
+	// webhookQueue is a sorted set of pending deliveries scored by when
+	// they are next due
+	webhookQueue = "webhooks:queue"
+	// WebhookDeadLetters lists deliveries that ran out of attempts
+	WebhookDeadLetters = "webhooks:dead"
+)
+
+// Webhook is where a file's events are delivered and the secret their
+// signatures use
+type Webhook struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// WebhookDelivery is one signed request waiting to be sent. It is signed
+// when queued so the secret isn't kept with it.
+type WebhookDelivery struct {
+	ID    string `json:"id"`
+	URL   string `json:"url"`
+	Event string `json:"event"`
+	Body  string `json:"body"`
+	// Secret signs each attempt, so retries carry a fresh timestamp
+	Secret    string    `json:"secret"`
+	Operator  bool      `json:"operator,omitempty"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// member is the queue entry this delivery was leased as
+	member string
+}
+
+func StoreWebhook(id string, hook Webhook, expiry time.Duration) error {
+	u, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+	return rdb.Set(ctx, webhookPrefix+id, u, expiry).Err()
+}
+
+func GetWebhook(id string) (Webhook, error) {
+	val, err := rdb.Get(ctx, webhookPrefix+id).Bytes()
+	if err != nil {
+		return Webhook{}, err
+	}
+	var res Webhook
+	err = json.Unmarshal(val, &res)
+	return res, err
+}
+
+func DeleteWebhook(id string) error {
+	return rdb.Del(ctx, webhookPrefix+id).Err()
+}
+
+// QueueWebhookDelivery schedules delivery to be sent at the given time
+func QueueWebhookDelivery(delivery WebhookDelivery, at time.Time) error {
+	u, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	return rdb.ZAdd(ctx, webhookQueue, redis.Z{Score: float64(at.UnixMilli()), Member: u}).Err()
+}
+
+// leaseDeliveries atomically pushes due deliveries back by the lease, so
+// only one server sends each and a crashed server's deliveries come due
+// again
+var leaseDeliveries = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, member in ipairs(due) do
+	redis.call('ZADD', KEYS[1], ARGV[2], member)
+end
+return due
+`)
+
+// LeaseWebhookDeliveries takes up to count due deliveries for the length
+// of lease. Each must then be completed, retried or dead-lettered.
+func LeaseWebhookDeliveries(now time.Time, lease time.Duration, count int) ([]WebhookDelivery, error) {
+	due, err := leaseDeliveries.Run(ctx, rdb, []string{webhookQueue},
+		now.UnixMilli(), now.Add(lease).UnixMilli(), count).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	var leased []WebhookDelivery
+	for _, member := range due {
+		var delivery WebhookDelivery
+		if err := json.Unmarshal([]byte(member), &delivery); err != nil {
+			rdb.ZRem(ctx, webhookQueue, member)
+			continue
+		}
+		delivery.member = member
+		leased = append(leased, delivery)
+	}
+	return leased, nil
+}
+
+func CompleteWebhookDelivery(delivery WebhookDelivery) error {
+	return rdb.ZRem(ctx, webhookQueue, delivery.member).Err()
+}
+
+// RetryWebhookDelivery replaces a leased delivery with its updated copy,
+// due at the given time
+func RetryWebhookDelivery(delivery WebhookDelivery, at time.Time) error {
+	u, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, webhookQueue, delivery.member)
+		pipe.ZAdd(ctx, webhookQueue, redis.Z{Score: float64(at.UnixMilli()), Member: u})
+		return nil
+	})
+	return err
+}
+
+// DeadLetterWebhookDelivery moves a leased delivery to WebhookDeadLetters
+func DeadLetterWebhookDelivery(delivery WebhookDelivery) error {
+	u, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, webhookQueue, delivery.member)
+		pipe.LPush(ctx, WebhookDeadLetters, u)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseCIDRs parses a comma separated list of CIDR ranges. Bare IP
+// addresses are accepted and treated as single-host ranges.
+func ParseCIDRs(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", entry)
+			}
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// ContainsIP reports whether ip falls inside any of the given ranges
+func ContainsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP resolves the address of the client that made the request.
+// Forwarding headers are only honored when the direct peer is one of the
+// trusted proxies; X-Forwarded-For is walked from the right so that entries
+// appended by trusted proxies are skipped and spoofed entries on the left
+// are ignored. A malformed hop ends the walk at the last trusted address,
+// since anything left of it came from the client.
+func ClientIP(r *http.Request, trusted []*net.IPNet) string {
+	peer := hostOnly(r.RemoteAddr)
+	if !ContainsIP(trusted, net.ParseIP(peer)) {
+		return peer
+	}
+
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		last := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := hostOnly(strings.TrimSpace(hops[i]))
+			ip := net.ParseIP(hop)
+			if ip == nil {
+				return last
+			}
+			if i == 0 || !ContainsIP(trusted, ip) {
+				return ip.String()
+			}
+			last = ip.String()
+		}
+	}
+
+	if xrip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); xrip != nil {
+		return xrip.String()
+	}
+
+	return peer
+}
+
+// RequestIP returns the client address of a request whose RemoteAddr has
+// already been resolved by the real IP middleware
+func RequestIP(r *http.Request) net.IP {
+	return net.ParseIP(hostOnly(r.RemoteAddr))
+}
+
+func hostOnly(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseCIDRs("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		peer   string
+		xff    string
+		realIP string
+		want   string
+	}{
+		{"untrusted peer ignores headers", "203.0.113.9:4000", "198.51.100.1", "198.51.100.2", "203.0.113.9"},
+		{"first untrusted hop from the right", "10.0.0.1:4000", "1.1.1.1, 198.51.100.1, 10.0.0.2", "", "198.51.100.1"},
+		{"all hops trusted", "10.0.0.1:4000", "10.0.0.3, 10.0.0.2", "", "10.0.0.3"},
+		{"no forwarding headers", "10.0.0.1:4000", "", "", "10.0.0.1"},
+		{"X-Real-IP without X-Forwarded-For", "10.0.0.1:4000", "", "198.51.100.2", "198.51.100.2"},
+		{"malformed hop next to the peer", "10.0.0.1:4000", "198.51.100.1, garbage", "198.51.100.2", "10.0.0.1"},
+		{"malformed hop behind a trusted hop", "10.0.0.1:4000", "garbage, 10.0.0.2", "198.51.100.2", "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.peer
+		if tt.xff != "" {
+			r.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got := ClientIP(r, trusted); got != tt.want {
+			t.Errorf("%s: ClientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
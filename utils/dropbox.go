@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+var (
+	ErrInvalidPublicKey = errors.New("public_key must be a 32-byte X25519 key in base64 or hex")
+	ErrNotSealed        = errors.New("payload is too short to be a sealed box")
+)
+
+// ParsePublicKey decodes an X25519 public key given as standard or URL
+// base64, or hex
+func ParsePublicKey(s string) (*[32]byte, error) {
+	s = strings.TrimSpace(s)
+	var raw []byte
+	var err error
+	switch {
+	case len(s) == 64:
+		raw, err = hex.DecodeString(s)
+	case strings.ContainsAny(s, "-_"):
+		raw, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	default:
+		raw, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil || len(raw) != 32 {
+		return nil, ErrInvalidPublicKey
+	}
+	var key [32]byte
+	copy(key[:], raw)
+	return &key, nil
+}
+
+// SealToPublicKey encrypts data as a NaCl anonymous sealed box
+// (crypto_box_seal) so only the holder of the matching private key can
+// open it
+func SealToPublicKey(data []byte, publicKey *[32]byte) ([]byte, error) {
+	return box.SealAnonymous(nil, data, publicKey, rand.Reader)
+}
+
+// ValidateSealed does the structural check available without the private
+// key for payloads the client says it already sealed
+func ValidateSealed(data []byte) error {
+	if len(data) <= box.AnonymousOverhead {
+		return ErrNotSealed
+	}
+	return nil
+}
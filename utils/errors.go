@@ -3,11 +3,20 @@ package utils
 import "errors"
 
 var (
-	ErrFileTooLarge     = errors.New("file size exceeds 50MB limit")
-	ErrInvalidFileSize  = errors.New("invalid file size")
-	ErrInvalidDownloads = errors.New("downloads must be between 1 and 10")
-	ErrDownloadsExceeded = errors.New("downloads cannot exceed 10")
-	ErrInvalidExpiry    = errors.New("expiry must be at least 1 minute")
-	ErrExpiryExceeded   = errors.New("expiry cannot exceed 7 days (10080 minutes)")
+	ErrFileTooLarge          = errors.New("file size exceeds 50MB limit")
+	ErrInvalidFileSize       = errors.New("invalid file size")
+	ErrInvalidDownloads      = errors.New("downloads must be between 1 and 10")
+	ErrDownloadsExceeded     = errors.New("downloads cannot exceed 10")
+	ErrInvalidExpiry         = errors.New("expiry must be at least 1 minute")
+	ErrExpiryExceeded        = errors.New("expiry cannot exceed 7 days (10080 minutes)")
+	ErrAvailableFromPast     = errors.New("available_from must be in the future")
+	ErrAvailableFromExceeded = errors.New("available_from cannot be more than 7 days ahead")
+	ErrInvalidFuse           = errors.New("fuse must be at least 1 minute")
+	ErrFuseExceedsExpiry     = errors.New("fuse cannot be longer than the expiry")
+	ErrInvalidIdle           = errors.New("idle must be at least 1 minute")
+	ErrIdleExceedsExpiry     = errors.New("idle cannot be longer than the expiry")
+	ErrEmptySecret           = errors.New("secret text is required")
+	ErrSecretTooLarge        = errors.New("secret text exceeds 64KB limit")
+	ErrInvalidRequestUploads = errors.New("max_uploads must be between 1 and 50")
+	ErrInvalidWebhookURL     = errors.New("webhook_url must be an absolute http or https URL")
 )
-
@@ -2,11 +2,37 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"math/big"
 )
 
-func GenerateID() string {
-	arr := make([]byte, 6)
-	rand.Read(arr)
-	return hex.EncodeToString(arr)
+// GenerateToken returns a random hex secret of n bytes
+func GenerateToken(n int) (string, error) {
+	arr := make([]byte, n)
+	if _, err := rand.Read(arr); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(arr), nil
+}
+
+// GenerateCode returns a random numeric code of the given number of digits
+func GenerateCode(digits int) (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < digits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
+
+// HashToken returns the hex SHA-256 of a secret token so it can be stored
+// and looked up without keeping the token itself
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
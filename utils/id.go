@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// ID formats for generated file ids
+const (
+	IDFormatHex       = "hex"
+	IDFormatCrockford = "crockford"
+	IDFormatWords     = "words"
+)
+
+const (
+	hexAlphabet = "0123456789abcdef"
+	// crockfordAlphabet is Crockford's base32, lower-cased for URLs. It
+	// leaves out i, l, o and u, which are read as 1, 1 and 0 on lookup.
+	crockfordAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+	wordSeparator     = "-"
+)
+
+// idFormats gives each format's default and minimum length, in characters
+// or words. Minimums keep at least the 48 bits the original ids had.
+var idFormats = map[string]struct{ defaultLength, minLength, maxLength int }{
+	IDFormatHex:       {16, 12, 64},
+	IDFormatCrockford: {13, 10, 64},
+	IDFormatWords:     {8, 6, 16},
+}
+
+type idConfig struct {
+	format   string
+	length   int
+	checksum bool
+}
+
+var idCfg = idConfig{format: IDFormatHex, length: 16}
+
+// SetIDFormat configures generated ids: the format, the length in
+// characters or words (0 for the format's default) and whether a checksum
+// character, or word, is appended to catch typos
+func SetIDFormat(format string, length int, checksum bool) error {
+	limits, ok := idFormats[format]
+	if !ok {
+		return fmt.Errorf("unknown id format %q", format)
+	}
+	if length == 0 {
+		length = limits.defaultLength
+	}
+	if length < limits.minLength || length > limits.maxLength {
+		return fmt.Errorf("%s ids must be between %d and %d long", format, limits.minLength, limits.maxLength)
+	}
+	idCfg = idConfig{format: format, length: length, checksum: checksum}
+	return nil
+}
+
+// GenerateID returns a new random id in the configured format
+func GenerateID() (string, error) {
+	symbols := idSymbols()
+	parts := make([]string, idCfg.length)
+	max := big.NewInt(int64(len(symbols)))
+	for i := range parts {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = symbols[n.Int64()]
+	}
+	if idCfg.checksum {
+		parts = append(parts, idChecksum(parts))
+	}
+	return strings.Join(parts, idSeparator()), nil
+}
+
+// IsGeneratedID reports whether id has the shape of a generated id, so
+// custom slugs can't take ids the generator might hand out
+func IsGeneratedID(id string) bool {
+	_, ok := splitID(id)
+	return ok
+}
+
+// ReservedSlug reports whether a custom slug can't be used: it has the
+// shape of a generated id, or lookups would rewrite it to something else
+// and never find it
+func ReservedSlug(slug string) bool {
+	normalized := NormalizeID(slug)
+	return normalized != slug || IsGeneratedID(normalized)
+}
+
+// NormalizeID undoes common typing slips in generated ids: case, and for
+// Crockford ids the look-alike letters i, l and o. It returns "" when id
+// is in the generated shape but its checksum doesn't match, and other ids
+// such as custom slugs unchanged.
+func NormalizeID(id string) string {
+	candidate := strings.ToLower(id)
+	if idCfg.format == IDFormatCrockford {
+		candidate = strings.NewReplacer("i", "1", "l", "1", "o", "0").Replace(candidate)
+	}
+	parts, ok := splitID(candidate)
+	if !ok {
+		return id
+	}
+	if idCfg.checksum && idChecksum(parts[:len(parts)-1]) != parts[len(parts)-1] {
+		return ""
+	}
+	return candidate
+}
+
+// splitID breaks id into its symbols if it has the configured shape,
+// including the checksum when enabled
+func splitID(id string) ([]string, bool) {
+	length := idCfg.length
+	if idCfg.checksum {
+		length++
+	}
+	var parts []string
+	if idCfg.format == IDFormatWords {
+		parts = strings.Split(id, wordSeparator)
+	} else {
+		parts = strings.Split(id, "")
+	}
+	if len(parts) != length {
+		return nil, false
+	}
+	symbols := idSymbols()
+	for _, part := range parts {
+		if !slices.Contains(symbols, part) {
+			return nil, false
+		}
+	}
+	return parts, true
+}
+
+// idChecksum picks the symbol for the hash of the id's symbols. Every
+// alphabet divides 256, so all symbols are equally likely and a typo goes
+// unnoticed only once in len(alphabet).
+func idChecksum(parts []string) string {
+	symbols := idSymbols()
+	sum := sha256.Sum256([]byte(strings.Join(parts, wordSeparator)))
+	return symbols[int(sum[0])%len(symbols)]
+}
+
+func idSymbols() []string {
+	switch idCfg.format {
+	case IDFormatWords:
+		return Words
+	case IDFormatCrockford:
+		return strings.Split(crockfordAlphabet, "")
+	default:
+		return strings.Split(hexAlphabet, "")
+	}
+}
+
+func idSeparator() string {
+	if idCfg.format == IDFormatWords {
+		return wordSeparator
+	}
+	return ""
+}
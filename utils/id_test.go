@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+// useIDFormat configures ids for one test and restores the default after
+func useIDFormat(t *testing.T, format string, length int, checksum bool) {
+	t.Helper()
+	original := idCfg
+	if err := SetIDFormat(format, length, checksum); err != nil {
+		t.Fatalf("SetIDFormat: %v", err)
+	}
+	t.Cleanup(func() { idCfg = original })
+}
+
+func generate(t *testing.T) string {
+	t.Helper()
+	id, err := GenerateID()
+	if err != nil {
+		t.Fatalf("GenerateID: %v", err)
+	}
+	return id
+}
+
+func TestSetIDFormatRejectsShortIDs(t *testing.T) {
+	if err := SetIDFormat(IDFormatHex, 8, false); err == nil {
+		t.Error("8 character hex ids were accepted")
+	}
+	if err := SetIDFormat("base64", 0, false); err == nil {
+		t.Error("unknown format was accepted")
+	}
+}
+
+func TestCrockfordIDs(t *testing.T) {
+	useIDFormat(t, IDFormatCrockford, 0, false)
+	id := generate(t)
+	if len(id) != 13 {
+		t.Fatalf("id %q has %d characters, want 13", id, len(id))
+	}
+	if strings.ContainsAny(id, "ilou") {
+		t.Errorf("id %q uses letters outside Crockford's alphabet", id)
+	}
+	if !IsGeneratedID(id) || NormalizeID(strings.ToUpper(id)) != id {
+		t.Errorf("id %q doesn't round-trip through NormalizeID", id)
+	}
+	if got := NormalizeID("o1lio1lio1lio"); got != "0111011101110" {
+		t.Errorf("look-alike letters normalized to %q", got)
+	}
+}
+
+func TestWordIDs(t *testing.T) {
+	useIDFormat(t, IDFormatWords, 6, false)
+	id := generate(t)
+	words := strings.Split(id, "-")
+	if len(words) != 6 {
+		t.Fatalf("id %q has %d words, want 6", id, len(words))
+	}
+	if !IsGeneratedID(id) || NormalizeID(strings.ToUpper(id)) != id {
+		t.Errorf("id %q doesn't round-trip through NormalizeID", id)
+	}
+	if IsGeneratedID("acid-acorn-actor-adobe-agent-notaword") {
+		t.Error("id with an unknown word has the generated shape")
+	}
+}
+
+func TestChecksumCatchesTypos(t *testing.T) {
+	for _, format := range []string{IDFormatHex, IDFormatCrockford, IDFormatWords} {
+		t.Run(format, func(t *testing.T) {
+			useIDFormat(t, format, 0, true)
+			id := generate(t)
+			if NormalizeID(id) != id {
+				t.Fatalf("valid id %q rejected", id)
+			}
+			parts := strings.Split(id, idSeparator())
+			check := parts[len(parts)-1]
+			for _, s := range idSymbols() {
+				if s == check {
+					continue
+				}
+				parts[len(parts)-1] = s
+				if typo := strings.Join(parts, idSeparator()); NormalizeID(typo) != "" {
+					t.Fatalf("id %q with the wrong checksum was accepted", typo)
+				}
+			}
+		})
+	}
+}
+
+func TestReservedSlug(t *testing.T) {
+	tests := []struct {
+		checksum bool
+		slug     string
+		reserved bool
+	}{
+		{false, "quarterly-report", false},
+		{false, "nda-2026", false},
+		{false, "hello-world", false},
+		{false, "0123456789abc", true},
+		// Lookups would read this as he110he110he1, so it could never be found
+		{false, "hellohellohel", true},
+		// With a checksum only the longer shape is rewritten, and its
+		// checksum fails
+		{true, "hellohellohel", false},
+		{true, "hellohellohelo", true},
+	}
+	for _, tt := range tests {
+		useIDFormat(t, IDFormatCrockford, 0, tt.checksum)
+		if got := ReservedSlug(tt.slug); got != tt.reserved {
+			t.Errorf("ReservedSlug(%q) with checksum=%v = %v, want %v", tt.slug, tt.checksum, got, tt.reserved)
+		}
+	}
+	useIDFormat(t, IDFormatCrockford, 0, true)
+	if id := generate(t); !ReservedSlug(id) {
+		t.Errorf("generated id %q is not reserved", id)
+	}
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+const MaxPGPKeys = 10
+
+var ErrNoPGPKeys = errors.New("pgp_key must contain at least one armored OpenPGP public key")
+
+// ParsePGPKeys reads armored OpenPGP public keys. Each entry may hold
+// several keys.
+func ParsePGPKeys(armored []string) (openpgp.EntityList, error) {
+	var keys openpgp.EntityList
+	for _, block := range armored {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(block))
+		if err != nil {
+			return nil, fmt.Errorf("invalid OpenPGP public key: %v", err)
+		}
+		keys = append(keys, entities...)
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoPGPKeys
+	}
+	if len(keys) > MaxPGPKeys {
+		return nil, fmt.Errorf("at most %d OpenPGP keys are allowed", MaxPGPKeys)
+	}
+	return keys, nil
+}
+
+// PGPFingerprint returns the upper-case hex fingerprint of a key's
+// primary key
+func PGPFingerprint(key *openpgp.Entity) string {
+	return strings.ToUpper(hex.EncodeToString(key.PrimaryKey.Fingerprint))
+}
+
+// EncryptToPGPKeys returns data as a binary OpenPGP message encrypted to
+// every key
+func EncryptToPGPKeys(data []byte, keys openpgp.EntityList, fileName string) ([]byte, error) {
+	var buf bytes.Buffer
+	hints := &openpgp.FileHints{IsBinary: true, FileName: fileName}
+	w, err := openpgp.Encrypt(&buf, keys, nil, hints, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
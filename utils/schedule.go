@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AccessWindow is a daily time-of-day range in a given location. Windows
+// whose end is before their start wrap past midnight (e.g. 22:00-06:00).
+type AccessWindow struct {
+	Start    int // minutes since midnight
+	End      int // minutes since midnight
+	Location *time.Location
+}
+
+// ParseAccessWindow parses a "HH:MM-HH:MM" range interpreted in the named
+// IANA time zone (UTC when empty)
+func ParseAccessWindow(window, timezone string) (AccessWindow, error) {
+	loc := time.UTC
+	if timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(timezone)
+		if err != nil {
+			return AccessWindow{}, fmt.Errorf("invalid timezone %q", timezone)
+		}
+	}
+
+	parts := strings.Split(window, "-")
+	if len(parts) != 2 {
+		return AccessWindow{}, fmt.Errorf("invalid access window %q, expected HH:MM-HH:MM", window)
+	}
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return AccessWindow{}, err
+	}
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return AccessWindow{}, err
+	}
+	if start == end {
+		return AccessWindow{}, fmt.Errorf("access window %q is empty", window)
+	}
+	return AccessWindow{Start: start, End: end, Location: loc}, nil
+}
+
+// Contains reports whether t falls inside the daily window
+func (w AccessWindow) Contains(t time.Time) bool {
+	local := t.In(w.Location)
+	minute := local.Hour()*60 + local.Minute()
+	if w.Start < w.End {
+		return minute >= w.Start && minute < w.End
+	}
+	return minute >= w.Start || minute < w.End
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const sealSaltSize = 16
+
+var ErrSealedData = errors.New("sealed data is corrupt or the key is wrong")
+
+// SealText encrypts text with XChaCha20-Poly1305 under a key derived from
+// secret with Argon2id. The result is base64 of salt || nonce || ciphertext.
+func SealText(text, secret string) (string, error) {
+	salt := make([]byte, sealSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	aead, err := chacha20poly1305.NewX(deriveSealKey(secret, salt))
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	out := append(salt, nonce...)
+	out = aead.Seal(out, nonce, []byte(text), nil)
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+// OpenText reverses SealText
+func OpenText(sealed, secret string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < sealSaltSize+chacha20poly1305.NonceSizeX {
+		return "", ErrSealedData
+	}
+	salt := raw[:sealSaltSize]
+	nonce := raw[sealSaltSize : sealSaltSize+chacha20poly1305.NonceSizeX]
+
+	aead, err := chacha20poly1305.NewX(deriveSealKey(secret, salt))
+	if err != nil {
+		return "", err
+	}
+	text, err := aead.Open(nil, nonce, raw[sealSaltSize+chacha20poly1305.NonceSizeX:], nil)
+	if err != nil {
+		return "", ErrSealedData
+	}
+	return string(text), nil
+}
+
+func deriveSealKey(secret string, salt []byte) []byte {
+	return argon2.IDKey([]byte(secret), salt, 2, 19*1024, 1, chacha20poly1305.KeySize)
+}
@@ -1,14 +1,22 @@
 package utils
 
 import (
+	"fmt"
+	"net/mail"
+	"net/url"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 const (
-	MaxFileSize      = 50 * 1024 * 1024
-	MaxDownloads     = 10
-	MaxExpiryMinutes = 10080
+	MaxFileSize        = 50 * 1024 * 1024
+	MaxDownloads       = 10
+	MaxExpiryMinutes   = 10080
+	MaxSecretSize      = 64 * 1024
+	MaxMessageLength   = 500
+	MaxRequestUploads  = 50
+	MaxEmailRecipients = 10
 )
 
 func SanitizeFilename(filename string) string {
@@ -41,6 +49,43 @@ func SanitizeFilename(filename string) string {
 	return filename
 }
 
+// ParseCountryCodes parses a comma separated list of ISO 3166-1 alpha-2
+// country codes and returns them upper-cased
+func ParseCountryCodes(list string) ([]string, error) {
+	var codes []string
+	for _, code := range strings.Split(list, ",") {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" {
+			continue
+		}
+		if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+			return nil, fmt.Errorf("invalid country code %q", code)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// ParseEmails parses a comma separated list of email addresses
+func ParseEmails(list string) ([]string, error) {
+	var emails []string
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		addr, err := mail.ParseAddress(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid email address %q", entry)
+		}
+		emails = append(emails, addr.Address)
+	}
+	if len(emails) > MaxEmailRecipients {
+		return nil, fmt.Errorf("at most %d email addresses are allowed", MaxEmailRecipients)
+	}
+	return emails, nil
+}
+
 // ValidateFileSize checks if file size is within limits
 func ValidateFileSize(size int64) error {
 	if size > MaxFileSize {
@@ -54,6 +99,34 @@ func ValidateFileSize(size int64) error {
 	return nil
 }
 
+// ValidateSecret checks that a text secret is present and within limits
+func ValidateSecret(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return ErrEmptySecret
+	}
+	if len(text) > MaxSecretSize {
+		return ErrSecretTooLarge
+	}
+	return nil
+}
+
+// SanitizeMessage cleans a sender note: control characters other than
+// newlines and tabs are dropped and the length is capped. The note stays
+// plain text, so it must be escaped wherever it is rendered as HTML.
+func SanitizeMessage(message string) string {
+	message = strings.Map(func(r rune) rune {
+		if r < 32 && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(message))
+
+	if runes := []rune(message); len(runes) > MaxMessageLength {
+		message = string(runes[:MaxMessageLength])
+	}
+	return message
+}
+
 // ValidateDownloads checks if download count is within limits
 func ValidateDownloads(downloads int) error {
 	if downloads < 1 {
@@ -65,6 +138,23 @@ func ValidateDownloads(downloads int) error {
 	return nil
 }
 
+// ValidateRequestUploads checks the upload limit of a file request
+func ValidateRequestUploads(uploads int) error {
+	if uploads < 1 || uploads > MaxRequestUploads {
+		return ErrInvalidRequestUploads
+	}
+	return nil
+}
+
+// ValidateWebhookURL checks that a webhook URL is absolute and uses HTTP(S)
+func ValidateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+	return nil
+}
+
 // ValidateExpiry checks if expiry time is within limits
 func ValidateExpiry(expiryMinutes int) error {
 	if expiryMinutes < 1 {
@@ -75,3 +165,39 @@ func ValidateExpiry(expiryMinutes int) error {
 	}
 	return nil
 }
+
+// ValidateFuse checks that a fuse length is positive and shorter than the
+// file's maximum lifetime
+func ValidateFuse(fuseMinutes, expiryMinutes int) error {
+	if fuseMinutes < 1 {
+		return ErrInvalidFuse
+	}
+	if fuseMinutes > expiryMinutes {
+		return ErrFuseExceedsExpiry
+	}
+	return nil
+}
+
+// ValidateIdle checks that a sliding idle window is positive and shorter
+// than the file's maximum lifetime
+func ValidateIdle(idleMinutes, expiryMinutes int) error {
+	if idleMinutes < 1 {
+		return ErrInvalidIdle
+	}
+	if idleMinutes > expiryMinutes {
+		return ErrIdleExceedsExpiry
+	}
+	return nil
+}
+
+// ValidateAvailableFrom checks that an embargo release time is in the
+// future and not further out than the maximum expiry
+func ValidateAvailableFrom(availableFrom, now time.Time) error {
+	if !availableFrom.After(now) {
+		return ErrAvailableFromPast
+	}
+	if availableFrom.Sub(now) > MaxExpiryMinutes*time.Minute {
+		return ErrAvailableFromExceeded
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package utils
+
+// Words is a list of 256 short, distinct English words used for
+// human-friendly codes. Clients pick code words from the same list, so
+// don't reorder or edit it.
+var Words = []string{
+	"acid", "acorn", "actor", "adobe", "agent", "alarm", "album", "alpha",
+	"amber", "anchor", "angle", "apple", "apron", "arena", "arrow", "atlas",
+	"attic", "autumn", "badge", "bagel", "baker", "bamboo", "banjo", "barn",
+	"basil", "beach", "beacon", "bear", "beetle", "bell", "berry", "bison",
+	"blade", "blanket", "blossom", "boat", "bonus", "book", "bottle",
+	"bounce", "brain", "brave", "bread", "brick", "bridge", "brook", "brush",
+	"bubble", "bucket", "buffalo", "bugle", "button", "cabin", "cactus",
+	"camel", "canal", "candle", "canoe", "canyon", "captain", "carbon",
+	"carpet", "castle", "cedar", "cello", "chalk", "cherry", "chess",
+	"circus", "citrus", "clock", "cloud", "clover", "coast", "cobalt",
+	"comet", "compass", "copper", "coral", "cotton", "crane", "crater",
+	"cricket", "crystal", "cube", "dagger", "daisy", "delta", "desert",
+	"diamond", "dinner", "dolphin", "domino", "dragon", "drum", "eagle",
+	"echo", "elbow", "ember", "engine", "falcon", "feather", "fern", "fiddle",
+	"flame", "flute", "forest", "fossil", "fox", "galaxy", "garden", "garlic",
+	"gecko", "ginger", "glacier", "globe", "goose", "granite", "grape",
+	"guitar", "hammer", "harbor", "harvest", "hazel", "helmet", "heron",
+	"hollow", "honey", "hornet", "igloo", "island", "ivory", "jacket",
+	"jaguar", "jasmine", "jelly", "jewel", "jungle", "kayak", "kernel",
+	"kettle", "kitten", "koala", "ladder", "lagoon", "lantern", "lemon",
+	"lilac", "lime", "linen", "lizard", "lobster", "lotus", "magnet", "mango",
+	"maple", "marble", "meadow", "melon", "meteor", "mint", "mirror",
+	"monkey", "moose", "mosaic", "motor", "mustard", "napkin", "nectar",
+	"needle", "nickel", "noodle", "nutmeg", "oasis", "ocean", "olive",
+	"onion", "opal", "orbit", "orchid", "otter", "oyster", "paddle", "panda",
+	"paper", "parrot", "peach", "pebble", "pepper", "piano", "pickle",
+	"pilot", "pine", "planet", "plum", "pocket", "polar", "pony", "poppy",
+	"prism", "pumpkin", "puzzle", "quail", "quartz", "quilt", "rabbit",
+	"radar", "radish", "raven", "ribbon", "river", "robot", "rocket",
+	"saddle", "salmon", "sandal", "saturn", "scarf", "shadow", "shell",
+	"silver", "sketch", "sparrow", "spider", "sponge", "spruce", "squid",
+	"stamp", "summit", "sunset", "swan", "tango", "teapot", "tiger", "timber",
+	"tomato", "topaz", "torch", "tulip", "tunnel", "turtle", "velvet",
+	"violin", "wagon", "walnut", "walrus", "whale", "willow", "window",
+	"winter", "wizard", "yacht", "yogurt", "zebra", "zenith", "zigzag",
+}
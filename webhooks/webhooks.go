@@ -0,0 +1,284 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Morizz00/self-destruct-share-api/storage"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// eventGroup is the consumer group the dispatcher reads events with
+	eventGroup      = "webhooks"
+	maxAttempts     = 8
+	firstRetry      = 30 * time.Second
+	maxRetry        = time.Hour
+	deliveryTimeout = 10 * time.Second
+	deliveryLease   = 2 * deliveryTimeout
+	deliveryBatch   = 20
+	// staleEvent is how long an event that failed to queue waits before
+	// it is read again
+	staleEvent = time.Minute
+)
+
+// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the
+// timestamp header, a dot and the body
+const SignatureHeader = "X-Webhook-Signature"
+
+// deliveredEvents are the event types sent to webhooks
+var deliveredEvents = map[string]bool{
+	storage.EventDownloaded: true,
+	storage.EventDestroyed:  true,
+	storage.EventRevoked:    true,
+	storage.EventExpired:    true,
+}
+
+var (
+	operatorURL    string
+	operatorSecret string
+
+	// Uploader-supplied URLs may only reach public addresses, unless
+	// WEBHOOK_ALLOW_PRIVATE is set for local development. Tests swap in
+	// a client for their local receiver.
+	uploaderClient = &http.Client{
+		Timeout: deliveryTimeout,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{Timeout: deliveryTimeout, Control: publicOnly}).DialContext,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	operatorClient = &http.Client{Timeout: deliveryTimeout}
+
+	// Outcomes of a delivery attempt, swapped for recorders when testing
+	completeDelivery   = storage.CompleteWebhookDelivery
+	retryDelivery      = storage.RetryWebhookDelivery
+	deadLetterDelivery = storage.DeadLetterWebhookDelivery
+)
+
+// Sign returns the signature of a webhook body sent at timestamp
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a received webhook's signature header
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Run dispatches webhooks for file events until the process exits. The
+// operator webhook comes from WEBHOOK_URL and WEBHOOK_SECRET.
+func Run() {
+	operatorURL = os.Getenv("WEBHOOK_URL")
+	operatorSecret = os.Getenv("WEBHOOK_SECRET")
+	if operatorURL != "" && operatorSecret == "" {
+		log.Printf("WARNING: WEBHOOK_URL is set without WEBHOOK_SECRET, operator webhook disabled")
+		operatorURL = ""
+	}
+	if os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true" {
+		uploaderClient = operatorClient
+	}
+
+	go deliverLoop()
+	consumeLoop()
+}
+
+// consumeLoop turns file events into queued deliveries. Reading through a
+// consumer group hands each event to one server only.
+func consumeLoop() {
+	hostname, _ := os.Hostname()
+	consumer := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	for {
+		if err := storage.EnsureEventGroup(eventGroup); err != nil {
+			log.Printf("Webhook error: failed to create consumer group: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		break
+	}
+
+	for {
+		// Events left unacknowledged because queueing failed come round
+		// again, so Redis hiccups delay deliveries instead of losing them
+		stale, err := storage.ClaimStaleEvents(eventGroup, consumer, staleEvent, 50)
+		if err != nil {
+			log.Printf("Webhook error: failed to claim stale events: %v", err)
+		}
+		events, err := storage.ReadEventGroup(eventGroup, consumer, 50, 5*time.Second)
+		if err != nil {
+			log.Printf("Webhook error: failed to read events: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		for _, event := range append(stale, events...) {
+			if deliveredEvents[event.Type] {
+				if err := queueEvent(event); err != nil {
+					log.Printf("Webhook error: failed to queue deliveries, will retry: id=%s, error=%v", event.FileID, err)
+					continue
+				}
+			}
+			storage.AckEvent(eventGroup, event.StreamID)
+		}
+	}
+}
+
+// queueEvent queues the event's deliveries. An error means the event should
+// be read again; deliveries queued before it may then be sent twice, with
+// the same delivery id.
+func queueEvent(event storage.StreamEvent) error {
+	if operatorURL != "" {
+		if err := queue(event, operatorURL, operatorSecret, true); err != nil {
+			return err
+		}
+	}
+
+	hook, err := storage.GetWebhook(event.FileID)
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("loading webhook: %w", err)
+	}
+	if err := queue(event, hook.URL, hook.Secret, false); err != nil {
+		return err
+	}
+	if storage.IsFinalEvent(event.Type) {
+		storage.DeleteWebhook(event.FileID)
+	}
+	return nil
+}
+
+func queue(event storage.StreamEvent, url, secret string, operator bool) error {
+	body, err := json.Marshal(event.Event)
+	if err != nil {
+		return err
+	}
+	// Delivery ids follow the stream entry, so receivers can drop repeats
+	id := event.StreamID + "-file"
+	if operator {
+		id = event.StreamID + "-operator"
+	}
+	now := time.Now()
+	delivery := storage.WebhookDelivery{
+		ID:        id,
+		URL:       url,
+		Event:     event.Type,
+		Body:      string(body),
+		Secret:    secret,
+		Operator:  operator,
+		CreatedAt: now,
+	}
+	return storage.QueueWebhookDelivery(delivery, now)
+}
+
+func deliverLoop() {
+	for range time.Tick(time.Second) {
+		deliveries, err := storage.LeaseWebhookDeliveries(time.Now(), deliveryLease, deliveryBatch)
+		if err != nil {
+			log.Printf("Webhook error: failed to lease deliveries: %v", err)
+			continue
+		}
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func(delivery storage.WebhookDelivery) {
+				defer wg.Done()
+				deliver(delivery)
+			}(delivery)
+		}
+		wg.Wait()
+	}
+}
+
+// deliver sends one delivery and completes, retries or dead-letters it
+func deliver(delivery storage.WebhookDelivery) {
+	err := send(delivery)
+	if err == nil {
+		log.Printf("Webhook delivered: delivery=%s, event=%s", delivery.ID, delivery.Event)
+		completeDelivery(delivery)
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= maxAttempts {
+		log.Printf("Webhook error: giving up: delivery=%s, attempts=%d, error=%v", delivery.ID, delivery.Attempts, err)
+		deadLetterDelivery(delivery)
+		return
+	}
+	wait := backoff(delivery.Attempts)
+	log.Printf("Webhook error: retrying in %v: delivery=%s, attempts=%d, error=%v", wait, delivery.ID, delivery.Attempts, err)
+	retryDelivery(delivery, time.Now().Add(wait))
+}
+
+func send(delivery storage.WebhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, strings.NewReader(delivery.Body))
+	if err != nil {
+		return err
+	}
+	// Signed per attempt, so receivers rejecting stale timestamps still
+	// accept retries
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "FileOrcha-Webhooks/1.0")
+	req.Header.Set("X-Webhook-Id", delivery.ID)
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, timestamp, []byte(delivery.Body)))
+
+	client := uploaderClient
+	if delivery.Operator {
+		client = operatorClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// backoff doubles the wait after every failed attempt, up to maxRetry
+func backoff(attempts int) time.Duration {
+	wait := firstRetry
+	for i := 1; i < attempts && wait < maxRetry; i++ {
+		wait *= 2
+	}
+	return min(wait, maxRetry)
+}
+
+// publicOnly refuses connections to loopback, private and link-local
+// addresses, whatever the URL's host name resolved to
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("webhook address %s is not public", host)
+	}
+	return nil
+}
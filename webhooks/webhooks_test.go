@@ -0,0 +1,230 @@
+package webhooks
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Morizz00/self-destruct-share-api/storage"
+)
+
+const testSecret = "whsec_test"
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	body := []byte(`{"type":"downloaded","file_id":"abc123"}`)
+	signature := Sign(testSecret, "1700000000", body)
+
+	if !strings.HasPrefix(signature, "sha256=") || len(signature) != len("sha256=")+64 {
+		t.Fatalf("signature = %q, want sha256= and 64 hex characters", signature)
+	}
+	if !Verify(testSecret, "1700000000", body, signature) {
+		t.Error("Verify rejected its own signature")
+	}
+	if Verify("other", "1700000000", body, signature) {
+		t.Error("Verify accepted a signature made with another secret")
+	}
+	if Verify(testSecret, "1700000001", body, signature) {
+		t.Error("Verify accepted a signature for another timestamp")
+	}
+	if Verify(testSecret, "1700000000", append(body, ' '), signature) {
+		t.Error("Verify accepted a modified body")
+	}
+}
+
+// receiver is a local webhook endpoint answering with the given statuses
+// in turn, recording what it received
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	status := rc.statuses[min(len(rc.requests), len(rc.statuses)-1)]
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, string(body))
+	w.WriteHeader(status)
+}
+
+// outcomes records what deliver decided instead of writing to Redis
+type outcomes struct {
+	completed  []storage.WebhookDelivery
+	retried    []storage.WebhookDelivery
+	retryAt    []time.Time
+	deadLetter []storage.WebhookDelivery
+}
+
+// startReceiver serves rc locally and points deliveries at it. The
+// httptest client is injected because the uploader client refuses
+// loopback addresses.
+func startReceiver(t *testing.T, rc *receiver) (*httptest.Server, *outcomes) {
+	t.Helper()
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+
+	out := &outcomes{}
+	originalClient := uploaderClient
+	originalComplete, originalRetry, originalDead := completeDelivery, retryDelivery, deadLetterDelivery
+	uploaderClient = srv.Client()
+	completeDelivery = func(d storage.WebhookDelivery) error {
+		out.completed = append(out.completed, d)
+		return nil
+	}
+	retryDelivery = func(d storage.WebhookDelivery, at time.Time) error {
+		out.retried = append(out.retried, d)
+		out.retryAt = append(out.retryAt, at)
+		return nil
+	}
+	deadLetterDelivery = func(d storage.WebhookDelivery) error {
+		out.deadLetter = append(out.deadLetter, d)
+		return nil
+	}
+	t.Cleanup(func() {
+		uploaderClient = originalClient
+		completeDelivery, retryDelivery, deadLetterDelivery = originalComplete, originalRetry, originalDead
+	})
+	return srv, out
+}
+
+func testDelivery(url string) storage.WebhookDelivery {
+	return storage.WebhookDelivery{
+		ID:        "d1",
+		URL:       url,
+		Event:     storage.EventDownloaded,
+		Body:      `{"type":"downloaded","file_id":"abc123","downloads_left":1}`,
+		Secret:    testSecret,
+		CreatedAt: time.Now(),
+	}
+}
+
+func TestDeliverSignedRequest(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusNoContent}}
+	srv, out := startReceiver(t, rc)
+	delivery := testDelivery(srv.URL)
+
+	deliver(delivery)
+
+	if len(out.completed) != 1 || len(out.retried) != 0 || len(out.deadLetter) != 0 {
+		t.Fatalf("completed=%d retried=%d dead=%d, want one completion", len(out.completed), len(out.retried), len(out.deadLetter))
+	}
+	if len(rc.requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(rc.requests))
+	}
+	r := rc.requests[0]
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("got %s with Content-Type %q", r.Method, r.Header.Get("Content-Type"))
+	}
+	if r.Header.Get("X-Webhook-Id") != "d1" || r.Header.Get("X-Webhook-Event") != storage.EventDownloaded {
+		t.Errorf("X-Webhook-Id = %q, X-Webhook-Event = %q", r.Header.Get("X-Webhook-Id"), r.Header.Get("X-Webhook-Event"))
+	}
+	if rc.bodies[0] != delivery.Body {
+		t.Errorf("body = %q, want %q", rc.bodies[0], delivery.Body)
+	}
+	if !Verify(testSecret, r.Header.Get("X-Webhook-Timestamp"), []byte(rc.bodies[0]), r.Header.Get(SignatureHeader)) {
+		t.Error("receiver could not verify the signature")
+	}
+}
+
+func TestDeliverSignsEachAttempt(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusOK}}
+	srv, _ := startReceiver(t, rc)
+	// A retry of a delivery queued an hour ago
+	delivery := testDelivery(srv.URL)
+	delivery.CreatedAt = time.Now().Add(-time.Hour)
+	delivery.Attempts = 3
+
+	before := time.Now().Unix()
+	deliver(delivery)
+
+	r := rc.requests[0]
+	timestamp, err := strconv.ParseInt(r.Header.Get("X-Webhook-Timestamp"), 10, 64)
+	if err != nil || timestamp < before || timestamp > time.Now().Unix() {
+		t.Fatalf("X-Webhook-Timestamp = %q, want the time of the attempt", r.Header.Get("X-Webhook-Timestamp"))
+	}
+	if !Verify(testSecret, r.Header.Get("X-Webhook-Timestamp"), []byte(rc.bodies[0]), r.Header.Get(SignatureHeader)) {
+		t.Error("receiver could not verify the signature")
+	}
+}
+
+func TestDeliverRetriesWithBackoff(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusOK}}
+	srv, out := startReceiver(t, rc)
+	delivery := testDelivery(srv.URL)
+
+	// Each retry is fed back in, as the queue would after the wait
+	wantWaits := []time.Duration{firstRetry, 2 * firstRetry}
+	for i, want := range wantWaits {
+		before := time.Now()
+		deliver(delivery)
+		if len(out.retried) != i+1 {
+			t.Fatalf("attempt %d: retried %d times, want %d", i+1, len(out.retried), i+1)
+		}
+		delivery = out.retried[i]
+		if delivery.Attempts != i+1 || !strings.Contains(delivery.LastError, "unexpected status") {
+			t.Errorf("attempt %d: Attempts = %d, LastError = %q", i+1, delivery.Attempts, delivery.LastError)
+		}
+		if wait := out.retryAt[i].Sub(before); wait < want || wait > want+time.Second {
+			t.Errorf("attempt %d: retry after %v, want %v", i+1, wait, want)
+		}
+	}
+
+	deliver(delivery)
+	if len(out.completed) != 1 || len(out.deadLetter) != 0 {
+		t.Fatalf("completed=%d dead=%d after the receiver recovered", len(out.completed), len(out.deadLetter))
+	}
+	if len(rc.requests) != 3 {
+		t.Errorf("receiver got %d requests, want 3", len(rc.requests))
+	}
+}
+
+func TestBackoffIsCapped(t *testing.T) {
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute}
+	for i, w := range want {
+		if got := backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+	if got := backoff(20); got != maxRetry {
+		t.Errorf("backoff(20) = %v, want %v", got, maxRetry)
+	}
+}
+
+func TestDeliverDeadLettersAfterFinalAttempt(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusBadGateway}}
+	srv, out := startReceiver(t, rc)
+	delivery := testDelivery(srv.URL)
+	delivery.Attempts = maxAttempts - 1
+
+	deliver(delivery)
+
+	if len(out.deadLetter) != 1 || len(out.retried) != 0 || len(out.completed) != 0 {
+		t.Fatalf("completed=%d retried=%d dead=%d, want one dead letter", len(out.completed), len(out.retried), len(out.deadLetter))
+	}
+	dead := out.deadLetter[0]
+	if dead.Attempts != maxAttempts || dead.LastError != "unexpected status 502" {
+		t.Errorf("Attempts = %d, LastError = %q", dead.Attempts, dead.LastError)
+	}
+}
+
+func TestUploaderClientRefusesLoopback(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusOK}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	err := send(testDelivery(srv.URL))
+	if err == nil || !strings.Contains(err.Error(), "is not public") {
+		t.Fatalf("send to %s: err = %v, want a refused private address", srv.URL, err)
+	}
+	if len(rc.requests) != 0 {
+		t.Errorf("receiver got %d requests", len(rc.requests))
+	}
+}